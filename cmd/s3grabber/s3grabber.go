@@ -3,47 +3,56 @@ package main
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/go-kit/log"
-	"github.com/go-kit/log/level"
 	"github.com/oklog/run"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/vinted/S3Grabber/internal/cfg"
+	"github.com/vinted/S3Grabber/internal/downloader"
+	"github.com/vinted/S3Grabber/internal/installer"
 	"github.com/vinted/S3Grabber/internal/s3grabber"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
 // initializeLogger initializes a logger with the given parameters.
-func initializeLogger(logFormat string, logLevel string) log.Logger {
-	var logger log.Logger
+func initializeLogger(logFormat string, logLevel string) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: parseLogLevel(logLevel)}
 
+	var handler slog.Handler
 	switch logFormat {
 	case "JSON":
-		logger = log.NewJSONLogger(os.Stdout)
-	case "LOGFMT":
-		logger = log.NewLogfmtLogger(os.Stdout)
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	default:
+		handler = slog.NewTextHandler(os.Stdout, opts)
 	}
 
+	return slog.New(handler)
+}
+
+// parseLogLevel maps the --log-level flag onto a slog.Level, defaulting to
+// Debug for an unrecognized value.
+func parseLogLevel(logLevel string) slog.Level {
 	switch logLevel {
-	case "DEBUG":
-		logger = level.NewFilter(logger, level.AllowDebug())
 	case "INFO":
-		logger = level.NewFilter(logger, level.AllowInfo())
+		return slog.LevelInfo
 	case "WARN":
-		logger = level.NewFilter(logger, level.AllowWarn())
+		return slog.LevelWarn
 	case "ERROR":
-		logger = level.NewFilter(logger, level.AllowError())
+		return slog.LevelError
+	default:
+		return slog.LevelDebug
 	}
-
-	return logger
 }
 
-func setupHTTPServer(httpAddress string) (prometheus.Registerer, *http.Server) {
+func setupHTTPServer(httpAddress string) (prometheus.Registerer, *http.ServeMux, *http.Server) {
 	metricsRegistry := prometheus.NewRegistry()
 	registerer := prometheus.WrapRegistererWithPrefix("s3grabber_", metricsRegistry)
 
@@ -57,7 +66,7 @@ func setupHTTPServer(httpAddress string) (prometheus.Registerer, *http.Server) {
 		fmt.Fprint(w, "OK")
 	}))
 
-	return registerer, server
+	return registerer, mux, server
 }
 
 type s3grabberMetrics struct {
@@ -65,23 +74,175 @@ type s3grabberMetrics struct {
 	lastSuccessfulSyncTimestamp prometheus.Gauge
 }
 
+// syncState tracks whether the most recently attempted install succeeded.
+// It is shared between the interval polling loop and the /-/trigger/
+// endpoint, both of which can update it concurrently, so access is guarded
+// by mu.
+type syncState struct {
+	mu                sync.Mutex
+	lastSyncSucceeded bool
+}
+
+// grabberLocks serializes install attempts per grabber, so a triggered run
+// and the interval poll loop never install into the same grabber's
+// directory concurrently -- but installs for two unrelated grabbers are
+// free to run in parallel instead of queueing behind one global lock.
+type grabberLocks struct {
+	mu     sync.Mutex
+	byName map[string]*sync.Mutex
+}
+
+func newGrabberLocks() *grabberLocks {
+	return &grabberLocks{byName: map[string]*sync.Mutex{}}
+}
+
+// get returns the mutex for name, creating it on first use.
+func (l *grabberLocks) get(name string) *sync.Mutex {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	m, ok := l.byName[name]
+	if !ok {
+		m = &sync.Mutex{}
+		l.byName[name] = m
+	}
+	return m
+}
+
+// lockAll locks every one of names' mutexes, in sorted order so it can never
+// deadlock against a concurrent lockAll/get call locking the same names in a
+// different order, and returns a function that unlocks them all again.
+func (l *grabberLocks) lockAll(names []string) func() {
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+
+	mus := make([]*sync.Mutex, len(sorted))
+	for i, name := range sorted {
+		mus[i] = l.get(name)
+	}
+	for _, m := range mus {
+		m.Lock()
+	}
+	return func() {
+		for _, m := range mus {
+			m.Unlock()
+		}
+	}
+}
+
+// recordResult applies the outcome of one RunS3Grabber/RunS3GrabberOne call
+// to m and s, the same way regardless of whether it was triggered by the
+// poll loop or the trigger endpoint.
+func (s *syncState) recordResult(m *s3grabberMetrics, logger *slog.Logger, attemptedInstall bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		if attemptedInstall {
+			s.lastSyncSucceeded = false
+		}
+		m.syncErrorsTotal.Inc()
+		logger.Error("failed to run S3Grabber iteration", "err", err)
+		return
+	}
+
+	if attemptedInstall {
+		s.lastSyncSucceeded = true
+	}
+	if s.lastSyncSucceeded {
+		m.lastSuccessfulSyncTimestamp.SetToCurrentTime()
+	}
+}
+
+// triggerHandler registers POST /-/trigger/{grabber} on mux, letting an
+// operator or an S3 bucket-notification webhook run a single grabber on
+// demand instead of waiting for the next poll. locks is also held by the
+// poll loop so a triggered run and a scheduled one never install into the
+// same grabber's directory concurrently -- but a trigger for one grabber
+// never has to wait behind a sweep of a different, unrelated one.
+func triggerHandler(logger *slog.Logger, cfg cfg.GlobalConfig, dlMetrics *downloader.Metrics, instMetrics *installer.Metrics, m *s3grabberMetrics, state *syncState, locks *grabberLocks) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		grabberName := strings.TrimPrefix(r.URL.Path, "/-/trigger/")
+		if grabberName == "" {
+			http.Error(w, "missing grabber name", http.StatusBadRequest)
+			return
+		}
+
+		mu := locks.get(grabberName)
+		mu.Lock()
+		attemptedInstall, err := s3grabber.RunS3GrabberOne(logger, cfg, dlMetrics, instMetrics, grabberName)
+		mu.Unlock()
+
+		state.recordResult(m, logger, attemptedInstall, err)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "triggered %s (installed=%v)\n", grabberName, attemptedInstall)
+	}
+}
+
+// listGenerations prints every generation kept for a grabber, oldest first,
+// to stdout. It is a read-only, disk-only operation -- it doesn't talk to
+// the configured buckets at all.
+func listGenerations(configFile, grabberName string) error {
+	globalCfg, err := cfg.ReadConfig(configFile)
+	if err != nil {
+		return fmt.Errorf("reading config file %s: %w", configFile, err)
+	}
+
+	grabber, ok := globalCfg.Grabbers[grabberName]
+	if !ok {
+		return fmt.Errorf("no such grabber: %s", grabberName)
+	}
+
+	generations, err := installer.ListGenerations(grabber.Path)
+	if err != nil {
+		return fmt.Errorf("listing generations for %s: %w", grabberName, err)
+	}
+
+	for i, g := range generations {
+		fmt.Printf("%d\t%s\tsource-mod-time=%s\n", i, g.Timestamp.Format(time.RFC3339Nano), g.SourceModTime.Format(time.RFC3339Nano))
+	}
+	return nil
+}
+
 func main() {
-	configFile := kingpin.Flag("config-path", "Path to the configuration file or directory").Required().String()
-	interval := kingpin.Flag("interval", "How often the process should do the synchronization").Duration()
-	httpAddress := kingpin.Flag("http-address", "Listening address for the HTTP server").Default(":10010").String()
-	logFormat := kingpin.Flag("log-format", "Log format").Default("LOGFMT").Enum("JSON", "LOGFMT")
-	logLevel := kingpin.Flag("log-level", "Log level").Default("DEBUG").Enum("DEBUG", "INFO", "WARN", "ERROR")
+	app := kingpin.New("s3grabber", "Synchronizes files from S3-compatible buckets onto disk.")
 
-	kingpin.Parse()
+	runCmd := app.Command("run", "Synchronize all configured grabbers (default).").Default()
+	configFile := runCmd.Flag("config-path", "Path to the configuration file or directory").Required().String()
+	interval := runCmd.Flag("interval", "How often the process should do the synchronization").Duration()
+	httpAddress := runCmd.Flag("http-address", "Listening address for the HTTP server").Default(":10010").String()
+	logFormat := runCmd.Flag("log-format", "Log format").Default("LOGFMT").Enum("JSON", "LOGFMT")
+	logLevel := runCmd.Flag("log-level", "Log level").Default("DEBUG").Enum("DEBUG", "INFO", "WARN", "ERROR")
+
+	listGenerationsCmd := app.Command("list-generations", "List the installed generations kept for a grabber.")
+	listGenerationsConfigFile := listGenerationsCmd.Flag("config-path", "Path to the configuration file or directory").Required().String()
+	listGenerationsGrabber := listGenerationsCmd.Arg("grabber", "Grabber name, as configured under grabbers:").Required().String()
+
+	switch kingpin.MustParse(app.Parse(os.Args[1:])) {
+	case listGenerationsCmd.FullCommand():
+		if err := listGenerations(*listGenerationsConfigFile, *listGenerationsGrabber); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	logger := initializeLogger(*logFormat, *logLevel)
 	cfg, err := cfg.ReadConfig(*configFile)
 	if err != nil {
-		_ = level.Error(logger).Log("msg", "failed to read config file", "path", *configFile, "err", err.Error())
+		logger.Error("failed to read config file", "path", *configFile, "err", err)
 		os.Exit(1)
 	}
 
-	registerer, server := setupHTTPServer(*httpAddress)
+	registerer, mux, server := setupHTTPServer(*httpAddress)
 
 	m := &s3grabberMetrics{
 		syncErrorsTotal: promauto.With(registerer).NewCounter(prometheus.CounterOpts{
@@ -94,45 +255,48 @@ func main() {
 		}),
 	}
 
+	dlMetrics := downloader.NewMetrics(registerer)
+	instMetrics := installer.NewMetrics(registerer)
+
+	// NOTE(GiedriusS): start with true to avoid an alert at boot.
+	state := &syncState{lastSyncSucceeded: true}
+	// locks serializes every install attempt per grabber, whether it came
+	// from the poll loop below or the /-/trigger/ endpoint, so the two
+	// never race installing into the same grabber's directory at once. A
+	// full poll-loop sweep touches every grabber, so it locks all of them;
+	// a trigger only locks the one grabber it's running.
+	locks := newGrabberLocks()
+
+	mux.HandleFunc("/-/trigger/", triggerHandler(logger, cfg, dlMetrics, instMetrics, m, state, locks))
+
+	grabberNames := make([]string, 0, len(cfg.Grabbers))
+	for name := range cfg.Grabbers {
+		grabberNames = append(grabberNames, name)
+	}
+
 	g := &run.Group{}
 	ctx, cancel := context.WithCancel(context.Background())
 
 	g.Add(func() error {
 		if interval != nil && *interval != 0 {
-			// NOTE(GiedriusS): start with true to avoid an alert at boot.
-			var lastSyncSucceeded bool = true
-
 			t := time.NewTicker(*interval)
 			defer t.Stop()
 
 			for {
-				// If attempted && err == nil -> lastSyncSucceeded = true
-				// If !attempted && err == nil -> nothing
-				// If attempted && err != nil -> lastSyncSucceeded = false
-				if attemptedInstall, err := s3grabber.RunS3Grabber(logger, cfg); err != nil {
-					if attemptedInstall {
-						lastSyncSucceeded = false
-					}
-
-					m.syncErrorsTotal.Inc()
-					_ = level.Error(logger).Log("msg", "failed to run S3Grabber iteration", "err", err.Error())
-				} else {
-					if attemptedInstall {
-						lastSyncSucceeded = true
-					}
-
-					if lastSyncSucceeded {
-						m.lastSuccessfulSyncTimestamp.SetToCurrentTime()
-					}
-				}
+				unlock := locks.lockAll(grabberNames)
+				attemptedInstall, err := s3grabber.RunS3Grabber(logger, cfg, dlMetrics, instMetrics)
+				unlock()
+				state.recordResult(m, logger, attemptedInstall, err)
 				<-t.C
 			}
 		} else {
-			if _, err := s3grabber.RunS3Grabber(logger, cfg); err != nil {
+			unlock := locks.lockAll(grabberNames)
+			attemptedInstall, err := s3grabber.RunS3Grabber(logger, cfg, dlMetrics, instMetrics)
+			unlock()
+			if err != nil {
 				return err
-			} else {
-				m.lastSuccessfulSyncTimestamp.SetToCurrentTime()
 			}
+			state.recordResult(m, logger, attemptedInstall, nil)
 		}
 		return nil
 	}, func(err error) {
@@ -149,7 +313,7 @@ func main() {
 	})
 
 	if err := g.Run(); err != nil {
-		_ = level.Error(logger).Log("msg", "failed to run S3Grabber", "err", err.Error())
+		logger.Error("failed to run S3Grabber", "err", err)
 		os.Exit(1)
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -14,15 +15,60 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+// envVarPattern matches "${...}" placeholders understood by
+// replaceWithEnvironmentVariables: "${VAR}", "${VAR:-default}" and
+// "${file:/path/to/secret}".
+var envVarPattern = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// replaceWithEnvironmentVariables expands "${...}" placeholders in input:
+//
+//   - "${VAR}" is replaced with the value of the VAR environment variable.
+//   - "${VAR:-default}" is replaced with VAR's value, or default if VAR is
+//     unset or empty, mirroring shell parameter expansion.
+//   - "${file:/path/to/secret}" is replaced with the contents of the given
+//     file, with a single trailing newline stripped, for secrets mounted as
+//     files (e.g. Docker/Kubernetes secrets).
+//
+// A placeholder referencing an unset variable with no default, or a file
+// that can't be read, is left untouched so that Validate can report it
+// instead of silently substituting an empty string.
 func replaceWithEnvironmentVariables(input string) string {
-	re := regexp.MustCompile(`\${(\w+)}`)
-	return re.ReplaceAllStringFunc(input, func(s string) string {
-		trimmedKey := strings.Trim(input, `${}`)
-		val := os.Getenv(trimmedKey)
+	return envVarPattern.ReplaceAllStringFunc(input, func(match string) string {
+		inner := match[2 : len(match)-1]
+
+		if path, ok := strings.CutPrefix(inner, "file:"); ok {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return match
+			}
+			return strings.TrimSuffix(string(content), "\n")
+		}
+
+		name, def, hasDefault := strings.Cut(inner, ":-")
+		val, isSet := os.LookupEnv(name)
+		if !isSet || val == "" {
+			if hasDefault {
+				return def
+			}
+			if !isSet {
+				return match
+			}
+		}
 		return val
 	})
 }
 
+// unresolvedVariables returns the placeholder names left in s by
+// replaceWithEnvironmentVariables because they couldn't be resolved.
+func unresolvedVariables(s string) []string {
+	matches := envVarPattern.FindAllStringSubmatch(s, -1)
+	names := make([]string, 0, len(matches))
+	for _, m := range matches {
+		names = append(names, m[1])
+	}
+	return names
+}
+
 type credentialString string
 
 func (c *credentialString) UnmarshalYAML(unmarshal func(interface{}) error) error {
@@ -35,11 +81,277 @@ func (c *credentialString) UnmarshalYAML(unmarshal func(interface{}) error) erro
 	return nil
 }
 
+// LogValue redacts c so that logging a BucketConfig or AzureConfig with
+// slog never leaks the resolved credential.
+func (c credentialString) LogValue() slog.Value {
+	return slog.StringValue("REDACTED")
+}
+
 type BucketConfig struct {
+	// Type selects the object store backend this bucket is served by: "s3"
+	// (the default, for any S3-compatible store), "gcs", "azure",
+	// "filesystem" or "http". Backend-specific settings beyond Host/Bucket go
+	// under Config, decoded into the Config struct for Type (see
+	// GCSConfig/AzureConfig/FilesystemConfig/HTTPConfig).
+	Type string `yaml:"type"`
+
 	Host      string
 	AccessKey credentialString `yaml:"access_key"`
 	SecretKey credentialString `yaml:"secret_key"`
 	Bucket    string
+
+	// Region is the AWS region (or region-equivalent, for other
+	// S3-compatible providers) used to sign requests. Only meaningful for
+	// Type "s3"; required by some providers (e.g. Cloudflare R2) even though
+	// S3Grabber never relies on it for anything but signing.
+	Region string `yaml:"region"`
+	// SignatureVersion selects the request-signing scheme: "v4" (the
+	// default) or "v2". Only meaningful for Type "s3"; modern S3-compatible
+	// providers (MinIO, Ceph, R2) require v4.
+	SignatureVersion string `yaml:"signature_version"`
+	// UseVirtualHosted addresses the bucket as "bucket.host" instead of
+	// "host/bucket". Only meaningful for Type "s3".
+	UseVirtualHosted bool `yaml:"use_virtual_hosted"`
+
+	// CustomHostHeader, when set, overrides the Host header sent to Host and
+	// re-signs the request accordingly -- useful when Host is reached
+	// through a proxy or load balancer that expects the original bucket
+	// hostname. Only meaningful for Type "s3".
+	CustomHostHeader string `yaml:"custom_host_header"`
+
+	// Config holds backend-specific settings for Type; left unparsed here so
+	// each backend can decode it into its own struct.
+	Config yaml.Node `yaml:"config"`
+
+	// CredentialsSource, when set, resolves AccessKey/SecretKey (and
+	// optionally a session token) from an external secret store instead of
+	// using AccessKey/SecretKey directly. It is re-resolved on every sync, so
+	// a rotated secret is picked up without restarting S3Grabber. Only
+	// meaningful for Type "s3".
+	CredentialsSource *CredentialsSourceConfig `yaml:"credentials_source"`
+
+	// ManifestSuffix, when set, is appended to an object's key (or a
+	// directory grabber's prefix) to find a signed manifest listing the
+	// SHA-256 digest of every file that object/prefix should contain, e.g.
+	// "alerting_rules.tar.gz.manifest.json". Leave empty to skip integrity
+	// verification.
+	ManifestSuffix string `yaml:"manifest_suffix"`
+	// PublicKey is the PEM-encoded ed25519 public key used to verify the
+	// manifest's signature. Required when ManifestSuffix is set.
+	PublicKey string `yaml:"public_key"`
+
+	// Hedge tunes how BucketManager.GetFileHedged treats this bucket as a
+	// candidate replica. The zero value races this bucket only against
+	// exact timestamp matches, with no GET delay and no concurrency bound.
+	Hedge HedgeConfig `yaml:"hedge"`
+
+	// ChecksumSidecar enables BucketManager's SHA-256 sidecar integrity
+	// layer for this bucket: PutFile uploads a "<key>.sha256" sidecar
+	// alongside every object, and GetFile/FindNewestFile verify downloaded
+	// content against it, returning downloader.ErrChecksumMismatch on a
+	// mismatch. This is independent of ManifestSuffix/PublicKey above, which
+	// verify a signed manifest instead of a plain per-object digest.
+	ChecksumSidecar bool `yaml:"checksum_sidecar"`
+	// StrictChecksum, when ChecksumSidecar is set, fails GetFile outright if
+	// an object has no sidecar. The default (lax) skips verification for
+	// that object instead, so turning ChecksumSidecar on doesn't break
+	// reading objects uploaded before it was enabled.
+	StrictChecksum bool `yaml:"strict_checksum"`
+}
+
+// HedgeConfig tunes BucketManager.GetFileHedged's replica-racing behavior
+// for one bucket.
+type HedgeConfig struct {
+	// Skew is how far behind the newest replica's LastModified this bucket
+	// may be and still be raced as a candidate.
+	Skew time.Duration `yaml:"skew"`
+	// Delay staggers this bucket's GET by the given duration after the race
+	// starts, letting a cheaper or more reliable replica answer first
+	// without paying for a GET against this one. Zero fires immediately.
+	Delay time.Duration `yaml:"delay"`
+	// MaxConcurrent bounds how many candidate replicas GetFileHedged races
+	// at once, across the whole call -- the largest value configured among
+	// the candidates wins. Zero (the default, on every bucket) races every
+	// candidate.
+	MaxConcurrent int `yaml:"max_concurrent"`
+}
+
+// GCSConfig is BucketConfig.Config for Type "gcs". Bucket is the GCS bucket
+// name.
+type GCSConfig struct {
+	ProjectID string `yaml:"project_id"`
+	// CredentialsFile is a path to a service account JSON key file. Left
+	// empty to use Application Default Credentials.
+	CredentialsFile string `yaml:"credentials_file"`
+}
+
+// AzureConfig is BucketConfig.Config for Type "azure". Bucket is the blob
+// container name.
+type AzureConfig struct {
+	AccountName string           `yaml:"account_name"`
+	AccountKey  credentialString `yaml:"account_key"`
+}
+
+// FilesystemConfig is BucketConfig.Config for Type "filesystem". Path is the
+// root directory that acts as the bucket; object keys are relative paths
+// beneath it.
+type FilesystemConfig struct {
+	Path string `yaml:"path"`
+}
+
+// HTTPConfig is BucketConfig.Config for Type "http", for read-only artifact
+// servers. BaseURL is joined with an object's key to build the request URL.
+// Listing prefixes isn't supported, so this backend can only serve single
+// keyed objects, not a directory grabber's whole prefix.
+type HTTPConfig struct {
+	BaseURL string `yaml:"base_url"`
+}
+
+// CredentialsSourceConfig picks where a bucket's credentials come from.
+// Exactly one of Kubernetes, File or HTTP should be set; it is a
+// configuration error to set more than one.
+type CredentialsSourceConfig struct {
+	Kubernetes *KubernetesSecretSource `yaml:"kubernetes"`
+	File       *FileSecretSource       `yaml:"file"`
+	HTTP       *HTTPSecretSource       `yaml:"http"`
+}
+
+// KubernetesSecretSource resolves credentials from a Kubernetes Secret,
+// fetched from the in-cluster API server using the pod's own service
+// account. FieldAccessKey/FieldSecretKey/FieldSessionToken name the keys
+// inside the Secret's data map; FieldSessionToken may be left empty if the
+// bucket doesn't need one.
+type KubernetesSecretSource struct {
+	Namespace         string `yaml:"namespace"`
+	Name              string `yaml:"name"`
+	FieldAccessKey    string `yaml:"field_access_key"`
+	FieldSecretKey    string `yaml:"field_secret_key"`
+	FieldSessionToken string `yaml:"field_session_token"`
+}
+
+// FileSecretSource resolves credentials from a directory of CSI-mounted
+// secret files, one file per field, e.g. Dir + "/access_key". A single
+// trailing newline is trimmed from each file. SessionTokenFile may be left
+// empty.
+type FileSecretSource struct {
+	Dir              string `yaml:"dir"`
+	AccessKeyFile    string `yaml:"access_key_file"`
+	SecretKeyFile    string `yaml:"secret_key_file"`
+	SessionTokenFile string `yaml:"session_token_file"`
+}
+
+// HTTPSecretSource resolves credentials from a GET request to URL, which
+// must return a JSON object with "access_key", "secret_key" and, optionally,
+// "session_token" string fields.
+type HTTPSecretSource struct {
+	URL string `yaml:"url"`
+}
+
+// VerificationConfig gates a (file, i.e. archive) grabber's install on one or
+// more cryptographic checks of the downloaded artifact, each fetched as a
+// sidecar object alongside it in the same bucket. All of Checksum, Signature,
+// and Keyless that are configured must pass; at least one must be set for
+// verification to do anything. Not supported for directory grabbers, which
+// have no single artifact to attach a sidecar to.
+type VerificationConfig struct {
+	Checksum  *ChecksumVerification  `yaml:"checksum"`
+	Signature *SignatureVerification `yaml:"signature"`
+	Keyless   *KeylessVerification   `yaml:"keyless"`
+}
+
+// ChecksumVerification checks the downloaded artifact's digest against a
+// sidecar object at the grabber's object path plus Suffix (e.g.
+// "alerting_rules.tar.gz.sha256"), which may be a bare hex digest or the
+// "<digest>  <filename>" format sha256sum/sha512sum produce.
+type ChecksumVerification struct {
+	// Algorithm is "sha256" or "sha512". Defaults to "sha256".
+	Algorithm string `yaml:"algorithm"`
+	Suffix    string `yaml:"suffix"`
+}
+
+// SignatureVerification checks a detached signature sidecar object at the
+// grabber's object path plus Suffix against every key in PublicKeys until
+// one verifies. The sidecar may be a minisign signature file or a bare
+// base64-encoded ed25519 signature; PublicKeys entries may likewise be
+// minisign public keys, PEM-encoded ed25519 public keys, or bare
+// base64-encoded keys.
+type SignatureVerification struct {
+	Suffix     string   `yaml:"suffix"`
+	PublicKeys []string `yaml:"public_keys"`
+}
+
+// KeylessVerification checks a cosign-style keyless (Sigstore) signature
+// bundle sidecar object at the grabber's object path plus Suffix: the
+// artifact must be signed by a short-lived certificate issued by FulcioURL
+// to an identity matching Identity/Issuer, and that signature must be
+// recorded at RekorURL.
+type KeylessVerification struct {
+	Suffix    string `yaml:"suffix"`
+	FulcioURL string `yaml:"fulcio_url"`
+	RekorURL  string `yaml:"rekor_url"`
+	Identity  string `yaml:"identity"`
+	Issuer    string `yaml:"issuer"`
+}
+
+// RetentionConfig mirrors restic's forget semantics for the generations kept
+// under a grabber's Path after a versioned install (see installer.Installer).
+// KeepLast keeps the N most recent generations; KeepWithin keeps every
+// generation newer than the given duration. Both may be set together, in
+// which case a generation survives if either rule keeps it. Leaving both
+// zero keeps every generation forever, matching the grabber's behaviour
+// before retention existed.
+type RetentionConfig struct {
+	KeepLast   int           `yaml:"keep_last"`
+	KeepWithin time.Duration `yaml:"keep_within"`
+}
+
+// DownloadLimits bounds how aggressively a single grabber is allowed to pull
+// objects from its buckets. Both fields are optional; the zero value means
+// unlimited, i.e. the behaviour from before this existed.
+type DownloadLimits struct {
+	// MaxConcurrentDownloads caps how many objects a directory grabber fetches
+	// in parallel per sync. It has no effect on file grabbers, which only ever
+	// fetch one object.
+	MaxConcurrentDownloads int `yaml:"max_concurrent_downloads"`
+
+	// BytesPerSecond throttles the combined read rate across those downloads
+	// via a token bucket.
+	BytesPerSecond int64 `yaml:"bytes_per_second"`
+
+	// PartSize is the byte size of each Range request BucketManager.
+	// GetFileParallel splits a large file's download into. Zero defaults to
+	// 8 MiB.
+	PartSize int64 `yaml:"part_size"`
+
+	// PartConcurrency caps how many of those parts GetFileParallel fetches
+	// at once. Zero defaults to 4.
+	PartConcurrency int `yaml:"part_concurrency"`
+
+	// Retry governs how BucketManager retries a failed backend operation
+	// against these buckets. The zero value disables retries, i.e. the
+	// behaviour from before this existed. See RetryStrategy.
+	Retry RetryStrategy `yaml:"retry"`
+}
+
+// RetryStrategy governs how many times and how long BucketManager retries a
+// failed backend operation before giving up, in the spirit of goamz's
+// aws.AttemptStrategy. The zero value disables retries entirely, i.e. the
+// behaviour from before this existed.
+type RetryStrategy struct {
+	// Total caps the wall-clock time spent retrying a single operation,
+	// across all attempts. Zero means no wall-clock cap (MaxAttempts alone
+	// decides when to stop).
+	Total time.Duration `yaml:"total"`
+	// Min is the backoff before the first retry; Max caps how large the
+	// backoff is allowed to grow to as attempts continue to fail.
+	Min time.Duration `yaml:"min"`
+	Max time.Duration `yaml:"max"`
+	// Jitter randomizes each backoff instead of using it outright, to avoid
+	// every grabber retrying in lockstep after a shared backend blip.
+	Jitter bool `yaml:"jitter"`
+	// MaxAttempts caps the number of attempts, including the first. Zero
+	// means no limit from this field alone (Total alone decides).
+	MaxAttempts int `yaml:"max_attempts"`
 }
 
 type GrabberConfig struct {
@@ -50,11 +362,41 @@ type GrabberConfig struct {
 	Commands []string
 	Timeout  time.Duration
 	Shell    string
+
+	// RollbackCommands run, in order, after a failed install has been swapped
+	// back out for the previous generation. They receive no special
+	// treatment beyond that: a failure here does not retry or re-rollback.
+	RollbackCommands []string `yaml:"rollback_commands"`
+
+	// Retention decides how many past generations under Path are kept after
+	// a successful install. See RetentionConfig.
+	Retention RetentionConfig `yaml:"retention"`
+
+	// Keep and Remove are dockerignore-style glob patterns (negation with a
+	// leading "!" is supported) that decide which files under Path this
+	// grabber owns. Remove patterns are evaluated first, Keep patterns last,
+	// so a Keep always wins -- this lets one grabber claim a subtree of Path
+	// via Remove while another grabber coexists there via Keep.
+	Keep   []string
+	Remove []string
+
+	// Downloads bounds this grabber's concurrency and throughput against its
+	// buckets. See DownloadLimits.
+	Downloads DownloadLimits `yaml:"downloads"`
+
+	// Verification, if set, gates this grabber's install on cryptographic
+	// checks of the downloaded artifact. See VerificationConfig.
+	Verification *VerificationConfig `yaml:"verification"`
 }
 
 type GlobalConfig struct {
 	Buckets  map[string]BucketConfig  `yaml:"buckets"`
 	Grabbers map[string]GrabberConfig `yaml:"grabbers"`
+
+	// MaxConcurrentGrabbers caps how many grabbers are synchronized in
+	// parallel. 0 (the default) means unlimited, i.e. one goroutine per
+	// grabber, same as before this existed.
+	MaxConcurrentGrabbers int `yaml:"max_concurrent_grabbers"`
 }
 
 func (gc *GlobalConfig) Merge(other *GlobalConfig) error {
@@ -84,6 +426,10 @@ func (gc *GlobalConfig) Merge(other *GlobalConfig) error {
 		gc.Grabbers[grabberName] = grabberCfg
 	}
 
+	if gc.MaxConcurrentGrabbers == 0 {
+		gc.MaxConcurrentGrabbers = other.MaxConcurrentGrabbers
+	}
+
 	return nil
 }
 
@@ -95,6 +441,23 @@ func (gc *GlobalConfig) Validate() error {
 		}
 	}
 
+	for name, b := range gc.Buckets {
+		fields := []struct {
+			name  string
+			value string
+		}{
+			{"host", b.Host},
+			{"bucket", b.Bucket},
+			{"access_key", string(b.AccessKey)},
+			{"secret_key", string(b.SecretKey)},
+		}
+		for _, field := range fields {
+			for _, v := range unresolvedVariables(field.value) {
+				errs = multierror.Append(errs, fmt.Errorf("bucket %s: %s: unresolved mandatory variable %s", name, field.name, v))
+			}
+		}
+	}
+
 	return errs
 }
 
@@ -164,5 +527,15 @@ func ReadConfig(path string) (GlobalConfig, error) {
 		return GlobalConfig{}, fmt.Errorf("parsing YAML %s: %w", path, err)
 	}
 
+	for name, b := range ret.Buckets {
+		b.Host = replaceWithEnvironmentVariables(b.Host)
+		b.Bucket = replaceWithEnvironmentVariables(b.Bucket)
+		ret.Buckets[name] = b
+	}
+
+	if err := ret.Validate(); err != nil {
+		return GlobalConfig{}, fmt.Errorf("invalid config provided: %w", err)
+	}
+
 	return ret, nil
 }
@@ -173,3 +173,68 @@ access_key: ${test}`
 	require.Nil(t, yaml.Unmarshal([]byte(input), &cfg))
 	require.Equal(t, credentialString("foo"), cfg.AccessKey)
 }
+
+func TestReplaceWithEnvironmentVariables(t *testing.T) {
+	os.Unsetenv("S3GRABBER_TEST_UNSET")
+	os.Setenv("S3GRABBER_TEST_VAR", "bar")
+
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(secretFile, []byte("file-secret\n"), 0644))
+
+	for _, tcase := range []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "plain variable embedded in a larger string",
+			input:    "prefix-${S3GRABBER_TEST_VAR}-suffix",
+			expected: "prefix-bar-suffix",
+		},
+		{
+			name:     "unset variable with default",
+			input:    "${S3GRABBER_TEST_UNSET:-fallback}",
+			expected: "fallback",
+		},
+		{
+			name:     "set variable ignores default",
+			input:    "${S3GRABBER_TEST_VAR:-fallback}",
+			expected: "bar",
+		},
+		{
+			name:     "unset variable with no default is left untouched",
+			input:    "${S3GRABBER_TEST_UNSET}",
+			expected: "${S3GRABBER_TEST_UNSET}",
+		},
+		{
+			name:     "file reference",
+			input:    "${file:" + secretFile + "}",
+			expected: "file-secret",
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			require.Equal(t, tcase.expected, replaceWithEnvironmentVariables(tcase.input))
+		})
+	}
+}
+
+func TestValidate_UnresolvedVariables(t *testing.T) {
+	os.Unsetenv("S3GRABBER_TEST_UNSET")
+
+	path := filepath.Join(t.TempDir(), "test.yml")
+	require.NoError(t, os.WriteFile(path, []byte(`---
+buckets:
+  lithuania:
+    host: ${S3GRABBER_TEST_UNSET}
+    bucket: test
+grabbers:
+  alerting_rules:
+    file: "alerting_rules.tar.gz"`), os.ModePerm))
+
+	// ReadConfig's single-file branch must validate too, not just the
+	// directory-walking one -- a single --config-path file is a supported
+	// mode on its own.
+	_, err := ReadConfig(path)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unresolved mandatory variable S3GRABBER_TEST_UNSET")
+}
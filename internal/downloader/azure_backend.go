@@ -0,0 +1,143 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/vinted/S3Grabber/internal/cfg"
+)
+
+// azureBackend serves a bucket from an Azure Blob Storage container.
+type azureBackend struct {
+	client    *azblob.Client
+	container string
+}
+
+func newAzureBackend(ctx context.Context, bkt cfg.BucketConfig) (*azureBackend, error) {
+	var azCfg cfg.AzureConfig
+	if err := decodeBackendConfig(bkt, &azCfg); err != nil {
+		return nil, err
+	}
+	if azCfg.AccountName == "" {
+		return nil, fmt.Errorf("azure bucket: config.account_name is required")
+	}
+
+	cred, err := azblob.NewSharedKeyCredential(azCfg.AccountName, string(azCfg.AccountKey))
+	if err != nil {
+		return nil, fmt.Errorf("creating Azure credential: %w", err)
+	}
+
+	serviceURL := fmt.Sprintf("https://%s.blob.core.windows.net/", azCfg.AccountName)
+	client, err := azblob.NewClientWithSharedKeyCredential(serviceURL, cred, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating Azure client: %w", err)
+	}
+
+	return &azureBackend{client: client, container: bkt.Bucket}, nil
+}
+
+func (b *azureBackend) get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := b.client.DownloadStream(ctx, b.container, key, nil)
+	if err != nil {
+		if isAzureNotFound(err) {
+			return nil, errNotExist
+		}
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (b *azureBackend) getRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	resp, err := b.client.DownloadStream(ctx, b.container, key, &azblob.DownloadStreamOptions{
+		Range: azblob.HTTPRange{Offset: offset, Count: length},
+	})
+	if err != nil {
+		if isAzureNotFound(err) {
+			return nil, errNotExist
+		}
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (b *azureBackend) stat(ctx context.Context, key string) (time.Time, error) {
+	props, err := b.client.ServiceClient().NewContainerClient(b.container).NewBlobClient(key).GetProperties(ctx, nil)
+	if err != nil {
+		if isAzureNotFound(err) {
+			return time.Time{}, errNotExist
+		}
+		return time.Time{}, err
+	}
+	if props.LastModified == nil {
+		return time.Time{}, fmt.Errorf("blob %s has no last-modified time", key)
+	}
+	return *props.LastModified, nil
+}
+
+func (b *azureBackend) size(ctx context.Context, key string) (int64, error) {
+	props, err := b.client.ServiceClient().NewContainerClient(b.container).NewBlobClient(key).GetProperties(ctx, nil)
+	if err != nil {
+		if isAzureNotFound(err) {
+			return 0, errNotExist
+		}
+		return 0, err
+	}
+	if props.ContentLength == nil {
+		return 0, fmt.Errorf("blob %s has no content length", key)
+	}
+	return *props.ContentLength, nil
+}
+
+func (b *azureBackend) list(ctx context.Context, prefix string) ([]objectInfo, error) {
+	var objs []objectInfo
+	pager := b.client.NewListBlobsFlatPager(b.container, &azblob.ListBlobsFlatOptions{Prefix: &prefix})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Segment.BlobItems {
+			if item.Name == nil {
+				continue
+			}
+			var modTime time.Time
+			var size int64
+			var etag string
+			if item.Properties != nil {
+				if item.Properties.LastModified != nil {
+					modTime = *item.Properties.LastModified
+				}
+				if item.Properties.ContentLength != nil {
+					size = *item.Properties.ContentLength
+				}
+				if item.Properties.ETag != nil {
+					etag = string(*item.Properties.ETag)
+				}
+			}
+			objs = append(objs, objectInfo{Key: *item.Name, Size: size, LastModified: modTime, ETag: etag})
+		}
+	}
+	return objs, nil
+}
+
+func (b *azureBackend) put(ctx context.Context, key string, content io.Reader) error {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	_, err = b.client.UploadBuffer(ctx, b.container, key, data, nil)
+	return err
+}
+
+func (b *azureBackend) createBucket(ctx context.Context, name string) error {
+	_, err := b.client.CreateContainer(ctx, name, nil)
+	return err
+}
+
+func isAzureNotFound(err error) bool {
+	return bloberror.HasCode(err, bloberror.BlobNotFound)
+}
@@ -0,0 +1,89 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/vinted/S3Grabber/internal/cfg"
+)
+
+// errNotExist is returned by backend.stat when the key has no object,
+// analogous to minio's "NoSuchKey". Callers that search across several
+// buckets (FindNewestFile, GetFileHedged) treat it as "this bucket
+// doesn't have it" rather than a hard error.
+var errNotExist = errors.New("object does not exist")
+
+// readCloser pairs a Reader with an unrelated Closer, for backends whose
+// range reads are implemented by seeking and limiting a handle that must
+// still be closed in full.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// objectInfo describes one object returned by backend.list.
+type objectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+	ETag         string
+}
+
+// backend is the set of operations a single configured bucket needs to
+// support, regardless of which object store actually backs it. BucketManager
+// holds one backend per cfg.BucketConfig it was constructed with and
+// dispatches to it by bucketIndex, so every backend implementation is
+// interchangeable from the rest of the pipeline's point of view.
+type backend interface {
+	// get returns a reader for key's content.
+	get(ctx context.Context, key string) (io.ReadCloser, error)
+	// getRange returns a reader for the length bytes of key's content
+	// starting at offset.
+	getRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	// stat returns key's last modified time, or errNotExist if there's no
+	// such object.
+	stat(ctx context.Context, key string) (time.Time, error)
+	// size returns key's total content length in bytes, or errNotExist if
+	// there's no such object.
+	size(ctx context.Context, key string) (int64, error)
+	// list returns every object whose key starts with prefix (which always
+	// ends in "/").
+	list(ctx context.Context, prefix string) ([]objectInfo, error)
+	// put uploads content to key. Only used by tests.
+	put(ctx context.Context, key string, content io.Reader) error
+	// createBucket creates the backend's bucket/container. Only used by tests.
+	createBucket(ctx context.Context, name string) error
+}
+
+// newBackend builds the backend for bkt, dispatching on bkt.Type.
+func newBackend(ctx context.Context, bkt cfg.BucketConfig) (backend, error) {
+	switch bkt.Type {
+	case "", "s3":
+		return newS3Backend(ctx, bkt)
+	case "gcs":
+		return newGCSBackend(ctx, bkt)
+	case "azure":
+		return newAzureBackend(ctx, bkt)
+	case "filesystem":
+		return newFilesystemBackend(bkt)
+	case "http":
+		return newHTTPBackend(bkt)
+	default:
+		return nil, fmt.Errorf("unknown bucket type %q", bkt.Type)
+	}
+}
+
+// decodeBackendConfig decodes bkt.Config into out. It's a no-op, leaving out
+// untouched, if config: wasn't set at all.
+func decodeBackendConfig(bkt cfg.BucketConfig, out interface{}) error {
+	if bkt.Config.Kind == 0 {
+		return nil
+	}
+	if err := bkt.Config.Decode(out); err != nil {
+		return fmt.Errorf("decoding config for bucket type %q: %w", bkt.Type, err)
+	}
+	return nil
+}
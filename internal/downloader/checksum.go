@@ -0,0 +1,170 @@
+package downloader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// checksumSidecarSuffix is appended to an object's key to find its SHA-256
+// sidecar, e.g. "example.tar.gz.sha256".
+const checksumSidecarSuffix = ".sha256"
+
+// ErrChecksumMismatch is returned by a reader from GetFile once it reaches
+// EOF, if the bucket's cfg.BucketConfig.ChecksumSidecar is set and the
+// object's content doesn't match the digest in its .sha256 sidecar.
+var ErrChecksumMismatch = errors.New("checksum sidecar mismatch")
+
+// ErrChecksumSidecarMissing is returned by GetFile when
+// cfg.BucketConfig.StrictChecksum is set and an object has no .sha256
+// sidecar to verify against.
+var ErrChecksumSidecarMissing = errors.New("checksum sidecar missing")
+
+// ChecksumDivergenceError is returned by FindNewestFile when two or more
+// buckets report the same newest modTime for a path but disagree on its
+// SHA-256 sidecar digest. Identical modTimes ordinarily mean the same
+// upload was replicated everywhere, so a digest mismatch between them is a
+// sign of silent corruption or a poisoned replica rather than of one bucket
+// simply being behind.
+type ChecksumDivergenceError struct {
+	Path          string
+	ModTime       time.Time
+	BucketIndices []int
+	Digests       map[int]string
+}
+
+func (e *ChecksumDivergenceError) Error() string {
+	return fmt.Sprintf("checksum divergence for %s at %s: buckets %v disagree on sha256 digest: %v", e.Path, e.ModTime, e.BucketIndices, e.Digests)
+}
+
+func sidecarPath(path string) string {
+	return path + checksumSidecarSuffix
+}
+
+// sha256File hex-digests the content of filePath, for PutFile to upload
+// alongside the object it just wrote.
+func sha256File(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// fetchChecksumSidecar downloads and trims path's .sha256 sidecar from
+// bucketIndex. Returns errNotExist if the sidecar itself doesn't exist.
+func (m *BucketManager) fetchChecksumSidecar(ctx context.Context, path string, bucketIndex int) (string, error) {
+	rc, err := m.backends[bucketIndex].get(ctx, sidecarPath(path))
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	raw, err := io.ReadAll(rc)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(raw)), nil
+}
+
+// verifyChecksumSidecar wraps rc with a hashing reader that checks it
+// against path's .sha256 sidecar on bucketIndex, if
+// cfg.BucketConfig.ChecksumSidecar is set for that bucket. It closes rc and
+// returns an error instead if StrictChecksum is set and no sidecar exists.
+func (m *BucketManager) verifyChecksumSidecar(ctx context.Context, path string, bucketIndex int, rc io.ReadCloser) (io.ReadCloser, error) {
+	if !m.checksumSidecars[bucketIndex] {
+		return rc, nil
+	}
+
+	want, err := m.fetchChecksumSidecar(ctx, path, bucketIndex)
+	if err != nil {
+		if errors.Is(err, errNotExist) {
+			if m.strictChecksums[bucketIndex] {
+				rc.Close()
+				return nil, fmt.Errorf("%w: %s in %s", ErrChecksumSidecarMissing, path, m.bucketNames[bucketIndex])
+			}
+			return rc, nil
+		}
+		rc.Close()
+		return nil, fmt.Errorf("fetching checksum sidecar for %s: %w", path, err)
+	}
+	return newChecksumReader(rc, path, want), nil
+}
+
+// checksumReader wraps a backend's reader, computing a running SHA-256
+// digest as it is read, and fails the final Read with ErrChecksumMismatch if
+// the digest doesn't match want once the underlying reader is exhausted.
+type checksumReader struct {
+	rc   io.ReadCloser
+	h    hash.Hash
+	path string
+	want string
+}
+
+func newChecksumReader(rc io.ReadCloser, path, want string) *checksumReader {
+	return &checksumReader{rc: rc, h: sha256.New(), path: path, want: want}
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.rc.Read(p)
+	if n > 0 {
+		c.h.Write(p[:n])
+	}
+	if err == io.EOF {
+		if got := hex.EncodeToString(c.h.Sum(nil)); got != c.want {
+			return n, fmt.Errorf("%w: %s: expected sha256 %s, got %s", ErrChecksumMismatch, c.path, c.want, got)
+		}
+	}
+	return n, err
+}
+
+func (c *checksumReader) Close() error {
+	return c.rc.Close()
+}
+
+// checksumDivergence checks whether tied, a set of bucket indices that all
+// reported the same newest modTime for path, disagree on its checksum
+// sidecar. Buckets with ChecksumSidecar unset, or with no sidecar at all,
+// are skipped rather than treated as a mismatch.
+func (m *BucketManager) checksumDivergence(ctx context.Context, path string, tied []int) (digests map[int]string, divergent bool, err error) {
+	digests = make(map[int]string)
+	for _, idx := range tied {
+		if !m.checksumSidecars[idx] {
+			continue
+		}
+		d, err := m.fetchChecksumSidecar(ctx, path, idx)
+		if err != nil {
+			if errors.Is(err, errNotExist) {
+				continue
+			}
+			return nil, false, fmt.Errorf("fetching checksum sidecar from %s: %w", m.bucketNames[idx], err)
+		}
+		digests[idx] = d
+	}
+
+	var want string
+	first := true
+	for _, d := range digests {
+		if first {
+			want, first = d, false
+			continue
+		}
+		if d != want {
+			divergent = true
+		}
+	}
+	return digests, divergent, nil
+}
@@ -2,37 +2,385 @@ package downloader
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"net/http"
+	"log/slog"
 	"os"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/go-multierror"
-	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/credentials"
-	"github.com/minio/minio-go/v7/pkg/signer"
 	"github.com/vinted/S3Grabber/internal/cfg"
 )
 
-// BucketManager manages downloading files from multiple buckets.
-// The intention is to construct a BucketManager for each Installer.
+// BucketManager manages downloading files from multiple buckets, each of
+// which may be served by a different backend (see backend.go) -- plain
+// S3-compatible storage, GCS, Azure, a local directory, or a read-only HTTP
+// server. The intention is to construct a BucketManager for each Installer.
 type BucketManager struct {
-	bucketNames []string
-	clients     []*minio.Client
+	bucketNames      []string
+	backends         []backend
+	hedgeConfigs     []cfg.HedgeConfig
+	checksumSidecars []bool
+	strictChecksums  []bool
+
+	limits  cfg.DownloadLimits
+	limiter *rateLimiter
+	metrics *Metrics
+	logger  *slog.Logger
+}
+
+// NewBucketManager constructs a BucketManager backed by buckets. limits
+// bounds how many objects GetFiles fetches in parallel and how fast it reads
+// them; the zero value means unlimited. metrics, if non-nil, is updated as
+// downloads progress; pass the same *Metrics to every BucketManager so the
+// gauges reflect activity across all grabbers. logger defaults to
+// slog.Default() if nil.
+func NewBucketManager(ctx context.Context, buckets []cfg.BucketConfig, limits cfg.DownloadLimits, metrics *Metrics, logger *slog.Logger) (*BucketManager, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	backends := make([]backend, 0, len(buckets))
+	bucketNames := make([]string, 0, len(buckets))
+	hedgeConfigs := make([]cfg.HedgeConfig, 0, len(buckets))
+	checksumSidecars := make([]bool, 0, len(buckets))
+	strictChecksums := make([]bool, 0, len(buckets))
+	for _, bkt := range buckets {
+		b, err := newBackend(ctx, bkt)
+		if err != nil {
+			return nil, fmt.Errorf("constructing backend for %s: %w", bkt.Bucket, err)
+		}
+		backends = append(backends, newRetryBackend(b, bkt.Bucket, limits.Retry, metrics, logger))
+		bucketNames = append(bucketNames, bkt.Bucket)
+		hedgeConfigs = append(hedgeConfigs, bkt.Hedge)
+		checksumSidecars = append(checksumSidecars, bkt.ChecksumSidecar)
+		strictChecksums = append(strictChecksums, bkt.StrictChecksum)
+	}
+	return &BucketManager{
+		backends:         backends,
+		bucketNames:      bucketNames,
+		hedgeConfigs:     hedgeConfigs,
+		checksumSidecars: checksumSidecars,
+		strictChecksums:  strictChecksums,
+		limits:           limits,
+		limiter:          newRateLimiter(limits.BytesPerSecond),
+		metrics:          metrics,
+		logger:           logger,
+	}, nil
+}
+
+// wrapDownload applies the configured rate limit and updates the active
+// downloads/bytes metrics as rc is read, if either is configured.
+func (m *BucketManager) wrapDownload(ctx context.Context, rc io.ReadCloser) io.ReadCloser {
+	if m.limiter == nil && m.metrics == nil {
+		return rc
+	}
+	if m.metrics != nil {
+		m.metrics.activeDownloads.Inc()
+	}
+	return &limitedReadCloser{ctx: ctx, rc: rc, limiter: m.limiter, metrics: m.metrics}
 }
 
 // GetFile gets the provided file from the specified bucket index that was retrieved from FindNewestFile.
+// If that bucket's cfg.BucketConfig.ChecksumSidecar is set, the returned
+// reader also verifies the object against its ".sha256" sidecar, failing
+// the final Read with ErrChecksumMismatch on a mismatch.
 func (m *BucketManager) GetFile(ctx context.Context, path string, bucketIndex int) (io.ReadCloser, error) {
 	if err := m.indexInBounds(bucketIndex); err != nil {
 		return nil, err
 	}
-	obj, err := m.clients[bucketIndex].GetObject(ctx, m.bucketNames[bucketIndex], path, minio.GetObjectOptions{})
+	rc, err := m.backends[bucketIndex].get(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("getting %s from %s: %w", path, m.bucketNames[bucketIndex], err)
+	}
+	rc, err = m.verifyChecksumSidecar(ctx, path, bucketIndex, rc)
 	if err != nil {
-		return nil, fmt.Errorf("getting %s in %s: %w", path, m.clients[bucketIndex].EndpointURL(), err)
+		return nil, err
 	}
-	return obj, nil
+	return m.wrapDownload(ctx, rc), nil
+}
+
+// hedgeCandidate is one backend GetFileHedged decided to race.
+type hedgeCandidate struct {
+	index   int
+	modTime time.Time
+}
+
+// hedgeResult is what a single candidate's GET produced.
+type hedgeResult struct {
+	index int
+	rc    io.ReadCloser
+	err   error
+}
+
+// GetFileHedged is like GetFile, but instead of taking a bucketIndex already
+// picked by FindNewestFile, it stats path against every configured bucket in
+// parallel, races GETs against every replica whose LastModified is within
+// that bucket's cfg.HedgeConfig.Skew of the newest one seen, and returns the
+// reader of whichever replica answers first. Losing GETs are cancelled.
+// Each candidate's cfg.HedgeConfig.Delay staggers when its GET fires, and
+// the largest cfg.HedgeConfig.MaxConcurrent among the candidates bounds how
+// many of them race at once (0 means race them all).
+func (m *BucketManager) GetFileHedged(ctx context.Context, path string) (io.ReadCloser, error) {
+	if len(m.backends) == 0 {
+		return nil, fmt.Errorf("no clients configured")
+	}
+
+	type statResult struct {
+		index   int
+		modTime time.Time
+		err     error
+	}
+	stats := make([]statResult, len(m.backends))
+	var statWg sync.WaitGroup
+	for i, b := range m.backends {
+		i, b := i, b
+		statWg.Add(1)
+		go func() {
+			defer statWg.Done()
+			t, err := b.stat(ctx, path)
+			stats[i] = statResult{index: i, modTime: t, err: err}
+		}()
+	}
+	statWg.Wait()
+
+	var newest time.Time
+	var statErrs error
+	for _, s := range stats {
+		if s.err != nil {
+			if !errors.Is(s.err, errNotExist) {
+				statErrs = multierror.Append(statErrs, fmt.Errorf("statting %s in %s: %w", path, m.bucketNames[s.index], s.err))
+			}
+			continue
+		}
+		if s.modTime.After(newest) {
+			newest = s.modTime
+		}
+	}
+	if newest.IsZero() {
+		if statErrs != nil {
+			return nil, fmt.Errorf("getting %s: %w", path, statErrs)
+		}
+		return nil, fmt.Errorf("getting %s: no replica has this object", path)
+	}
+
+	candidates := make([]hedgeCandidate, 0, len(stats))
+	for _, s := range stats {
+		if s.err != nil {
+			continue
+		}
+		if newest.Sub(s.modTime) <= m.hedgeConfigs[s.index].Skew {
+			candidates = append(candidates, hedgeCandidate{index: s.index, modTime: s.modTime})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].modTime.After(candidates[j].modTime)
+	})
+
+	maxConcurrent := 0
+	for _, c := range candidates {
+		if mc := m.hedgeConfigs[c.index].MaxConcurrent; mc > maxConcurrent {
+			maxConcurrent = mc
+		}
+	}
+	var sem chan struct{}
+	if maxConcurrent > 0 && maxConcurrent < len(candidates) {
+		sem = make(chan struct{}, maxConcurrent)
+	}
+
+	type cancelableCandidate struct {
+		hedgeCandidate
+		cancel context.CancelFunc
+	}
+	running := make([]cancelableCandidate, 0, len(candidates))
+	resultsCh := make(chan hedgeResult, len(candidates))
+	var raceWg sync.WaitGroup
+
+	for _, c := range candidates {
+		c := c
+		cctx, cancel := context.WithCancel(ctx)
+		running = append(running, cancelableCandidate{c, cancel})
+
+		raceWg.Add(1)
+		go func() {
+			defer raceWg.Done()
+			if sem != nil {
+				select {
+				case sem <- struct{}{}:
+					defer func() { <-sem }()
+				case <-cctx.Done():
+					return
+				}
+			}
+			if d := m.hedgeConfigs[c.index].Delay; d > 0 {
+				select {
+				case <-time.After(d):
+				case <-cctx.Done():
+					return
+				}
+			}
+			rc, err := m.backends[c.index].get(cctx, path)
+			select {
+			case resultsCh <- hedgeResult{index: c.index, rc: rc, err: err}:
+			case <-cctx.Done():
+				if rc != nil {
+					rc.Close()
+				}
+			}
+		}()
+	}
+	go func() {
+		raceWg.Wait()
+		close(resultsCh)
+	}()
+
+	var winner *hedgeResult
+	var getErrs error
+	for r := range resultsCh {
+		r := r
+		if r.err != nil {
+			if !errors.Is(r.err, context.Canceled) {
+				getErrs = multierror.Append(getErrs, fmt.Errorf("getting %s from %s: %w", path, m.bucketNames[r.index], r.err))
+			}
+			continue
+		}
+		if winner != nil {
+			r.rc.Close()
+			continue
+		}
+		winner = &r
+		for _, c := range running {
+			if c.index != r.index {
+				c.cancel()
+			}
+		}
+	}
+
+	if winner == nil {
+		if getErrs != nil {
+			return nil, fmt.Errorf("getting %s: all replicas failed: %w", path, getErrs)
+		}
+		return nil, fmt.Errorf("getting %s: all replicas failed", path)
+	}
+	return m.wrapDownload(ctx, winner.rc), nil
+}
+
+const (
+	// defaultPartSize is used by GetFileParallel when cfg.DownloadLimits.
+	// PartSize isn't set.
+	defaultPartSize = 8 * 1024 * 1024
+	// defaultPartConcurrency is used by GetFileParallel when cfg.
+	// DownloadLimits.PartConcurrency isn't set.
+	defaultPartConcurrency = 4
+)
+
+// partResult is what one part's getRange call produced, handed from the
+// goroutine that fetched it to the assembler goroutine that streams it out
+// in order.
+type partResult struct {
+	rc  io.ReadCloser
+	err error
+}
+
+// GetFileParallel is like GetFile, but for large files: it splits path into
+// PartSize-byte ranges and fetches up to PartConcurrency of them at once,
+// while still handing the caller back a single io.ReadCloser that delivers
+// bytes in file order -- part N is only written out once part N-1 has been
+// fully drained, same as if GetFile had read the whole file sequentially.
+// If any part's getRange fails, any parts still in flight are cancelled and
+// the error surfaces on the returned reader's next Read. Falls back to
+// GetFile outright if path is no larger than one part.
+func (m *BucketManager) GetFileParallel(ctx context.Context, path string, bucketIndex int) (io.ReadCloser, error) {
+	if err := m.indexInBounds(bucketIndex); err != nil {
+		return nil, err
+	}
+	b := m.backends[bucketIndex]
+
+	total, err := b.size(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("statting size of %s from %s: %w", path, m.bucketNames[bucketIndex], err)
+	}
+
+	partSize := m.limits.PartSize
+	if partSize <= 0 {
+		partSize = defaultPartSize
+	}
+	if total <= partSize {
+		return m.GetFile(ctx, path, bucketIndex)
+	}
+
+	concurrency := m.limits.PartConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultPartConcurrency
+	}
+
+	numParts := int((total + partSize - 1) / partSize)
+	pctx, cancel := context.WithCancel(ctx)
+
+	results := make([]chan partResult, numParts)
+	for i := range results {
+		results[i] = make(chan partResult, 1)
+	}
+
+	sem := make(chan struct{}, concurrency)
+	for i := 0; i < numParts; i++ {
+		i := i
+		offset := int64(i) * partSize
+		length := partSize
+		if offset+length > total {
+			length = total - offset
+		}
+
+		go func() {
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-pctx.Done():
+				results[i] <- partResult{err: pctx.Err()}
+				return
+			}
+			rc, err := b.getRange(pctx, path, offset, length)
+			results[i] <- partResult{rc: rc, err: err}
+		}()
+	}
+
+	// drainRemaining closes every part reader at index from and later whose
+	// goroutine has already (or eventually does) send into results, so a
+	// part fetched successfully before a sibling's error was noticed
+	// doesn't leak its open connection.
+	drainRemaining := func(from int) {
+		for i := from; i < numParts; i++ {
+			if r := <-results[i]; r.rc != nil {
+				r.rc.Close()
+			}
+		}
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		defer cancel()
+		for i := 0; i < numParts; i++ {
+			r := <-results[i]
+			if r.err != nil {
+				pw.CloseWithError(fmt.Errorf("getting part %d of %s from %s: %w", i, path, m.bucketNames[bucketIndex], r.err))
+				drainRemaining(i + 1)
+				return
+			}
+			if _, err := io.Copy(pw, r.rc); err != nil {
+				r.rc.Close()
+				pw.CloseWithError(err)
+				drainRemaining(i + 1)
+				return
+			}
+			r.rc.Close()
+		}
+		pw.Close()
+	}()
+
+	return m.wrapDownload(ctx, pr), nil
 }
 
 type BucketFile struct {
@@ -41,72 +389,137 @@ type BucketFile struct {
 	Err     error
 }
 
+// ObjectInfo describes one object returned by ListFiles, for observability
+// and CLI use -- it's a copy of the backend-internal objectInfo, exported so
+// callers outside this package can inspect a listing without reaching for
+// GetFiles.
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+	ETag    string
+}
+
 // GetFiles gets all the files in provided path from the specified bucket index that was retrieved from FindNewestFile.
 func (m *BucketManager) GetFiles(ctx context.Context, prefix string, bucketIndex int) (<-chan BucketFile, error) {
 	if err := m.indexInBounds(bucketIndex); err != nil {
 		return nil, err
 	}
-	bucketClient := m.clients[bucketIndex]
-	bucketName := m.bucketNames[bucketIndex]
-
-	bucketObjects := make(chan BucketFile, 1)
+	b := m.backends[bucketIndex]
 
 	if !strings.HasSuffix(prefix, "/") {
 		prefix = prefix + "/"
 	}
 
+	bucketObjects := make(chan BucketFile, 1)
+
 	go func() {
 		defer close(bucketObjects)
-		var err error
-		objInfoCh := bucketClient.ListObjects(ctx, bucketName, minio.ListObjectsOptions{Prefix: prefix})
-		for objInfo := range objInfoCh {
-			// stop fetching files as soon as first error is encountered
-			if err != nil {
-				continue
-			}
-			if objInfo.Err != nil {
-				err = fmt.Errorf("listing objects: %w", err)
-				bucketObjects <- BucketFile{
-					Err: err,
-				}
-				continue
+
+		objs, err := b.list(ctx, prefix)
+		if err != nil {
+			bucketObjects <- BucketFile{Err: fmt.Errorf("listing objects: %w", err)}
+			return
+		}
+
+		workers := m.limits.MaxConcurrentDownloads
+		if workers <= 0 || workers > len(objs) {
+			workers = len(objs)
+		}
+		if workers == 0 {
+			return
+		}
+		sem := make(chan struct{}, workers)
+
+		var (
+			wg       sync.WaitGroup
+			failedMu sync.Mutex
+			failed   bool
+		)
+		// Stop fetching further files as soon as the first error is
+		// encountered, same as before concurrent fetching existed -- any
+		// object already in flight when that happens is still allowed to
+		// finish so the channel's consumer sees a clean, if incomplete, set.
+		fail := func(err error) {
+			failedMu.Lock()
+			alreadyFailed := failed
+			failed = true
+			failedMu.Unlock()
+			if !alreadyFailed {
+				bucketObjects <- BucketFile{Err: err}
 			}
+		}
+		hasFailed := func() bool {
+			failedMu.Lock()
+			defer failedMu.Unlock()
+			return failed
+		}
 
-			if objInfo.Key == prefix {
+		for _, obj := range objs {
+			obj := obj
+			if hasFailed() {
+				break
+			}
+			if obj.Key == prefix {
 				continue // not a file: prefix (directory)
 			}
+			if !strings.HasPrefix(obj.Key, prefix) {
+				// should not happen, but just to ensure safe prefix removal
+				fail(fmt.Errorf("key does not have expected prefix %s: %s", prefix, obj.Key))
+				break
+			}
 
-			obj, err := bucketClient.GetObject(ctx, bucketName, objInfo.Key, minio.GetObjectOptions{})
-			if err != nil {
-				err = fmt.Errorf("getting object %s: %w", objInfo.Key, err)
-				bucketObjects <- BucketFile{
-					Err: err,
+			sem <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				rc, err := b.get(ctx, obj.Key)
+				if err != nil {
+					m.logger.With("bucket_index", bucketIndex, "key", obj.Key).Debug("failed to get object", "err", err)
+					fail(fmt.Errorf("getting object %s: %w", obj.Key, err))
+					return
 				}
-				continue
-			}
-			if !strings.HasPrefix(objInfo.Key, prefix) {
-				// should not happen, but just to ensure safe prefix removal
-				err = fmt.Errorf("key does not have expected prefix %s: %s", prefix, objInfo.Key)
+
 				bucketObjects <- BucketFile{
-					Err: err,
+					Key:     obj.Key[len(prefix):],
+					Content: m.wrapDownload(ctx, rc),
 				}
-				continue
-			}
-			key := objInfo.Key[len(prefix):]
-
-			bucketObjects <- BucketFile{
-				Key:     key,
-				Content: obj,
-				Err:     nil,
-			}
+			}()
 		}
+
+		wg.Wait()
 	}()
 
 	return bucketObjects, nil
 }
 
+// ListFiles lists every object under prefix in the given bucket, for
+// observability/CLI use. Unlike GetFiles it doesn't fetch any object's
+// content.
+func (m *BucketManager) ListFiles(ctx context.Context, prefix string, bucketIndex int) ([]ObjectInfo, error) {
+	if err := m.indexInBounds(bucketIndex); err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix = prefix + "/"
+	}
+
+	objs, err := m.backends[bucketIndex].list(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("listing objects: %w", err)
+	}
+
+	infos := make([]ObjectInfo, len(objs))
+	for i, obj := range objs {
+		infos[i] = ObjectInfo{Key: obj.Key, Size: obj.Size, ModTime: obj.LastModified, ETag: obj.ETag}
+	}
+	return infos, nil
+}
+
 func (m *BucketManager) indexInBounds(bucketIndex int) error {
-	if bucketIndex < 0 || bucketIndex >= len(m.clients) {
+	if bucketIndex < 0 || bucketIndex >= len(m.backends) {
 		return fmt.Errorf("provided bucket index is out of bounds")
 	}
 	return nil
@@ -117,10 +530,13 @@ func (m *BucketManager) CreateBucket(ctx context.Context, name string, bucketInd
 	if err := m.indexInBounds(bucketIndex); err != nil {
 		return err
 	}
-	return m.clients[bucketIndex].MakeBucket(ctx, name, minio.MakeBucketOptions{})
+	return m.backends[bucketIndex].createBucket(ctx, name)
 }
 
-// PutFile puts the given file into the given path. Use only for tests.
+// PutFile puts the given file into the given path. Use only for tests. If
+// bucketIndex's cfg.BucketConfig.ChecksumSidecar is set, it also uploads a
+// ".sha256" sidecar alongside it for GetFile/FindNewestFile to verify
+// against.
 func (m *BucketManager) PutFile(ctx context.Context, filePath, bucketPath string, bucketIndex int) error {
 	if err := m.indexInBounds(bucketIndex); err != nil {
 		return err
@@ -130,85 +546,108 @@ func (m *BucketManager) PutFile(ctx context.Context, filePath, bucketPath string
 		return err
 	}
 	defer f.Close()
-	if _, err := m.clients[bucketIndex].PutObject(ctx, m.bucketNames[bucketIndex], bucketPath, f, -1, minio.PutObjectOptions{}); err != nil {
+	if err := m.backends[bucketIndex].put(ctx, bucketPath, f); err != nil {
 		return err
 	}
 
-	return nil
+	if !m.checksumSidecars[bucketIndex] {
+		return nil
+	}
+	digest, err := sha256File(filePath)
+	if err != nil {
+		return fmt.Errorf("hashing %s: %w", filePath, err)
+	}
+	return m.backends[bucketIndex].put(ctx, sidecarPath(bucketPath), strings.NewReader(digest+"\n"))
 }
 
-// FindNewestFile finds the newest file in all of the buckets with the provided path.
-// Returns the modification time and bucket index that later on needs to be passed to GetFile.
+// FindNewestFile finds the newest file in all of the buckets with the
+// provided path. Returns the modification time and bucket index that later
+// on needs to be passed to GetFile. If two or more buckets tie for newest
+// and disagree on their checksum sidecar (see
+// cfg.BucketConfig.ChecksumSidecar), it returns a *ChecksumDivergenceError
+// instead of silently picking one of them.
 func (m *BucketManager) FindNewestFile(ctx context.Context, path string) (modTime time.Time, bucketIndex int, err error) {
-	if len(m.clients) == 0 {
+	if len(m.backends) == 0 {
 		return modTime, bucketIndex, fmt.Errorf("no clients configured")
 	}
 
-	const notFoundCode = "NoSuchKey"
-
+	type statResult struct {
+		index   int
+		modTime time.Time
+	}
 	var (
-		errs       error
-		checkedOne bool
+		errs    error
+		results []statResult
 	)
 
-	for i, cl := range m.clients {
-		objInfo, err := cl.StatObject(ctx, m.bucketNames[i], path, minio.StatObjectOptions{})
-		if err != nil && minio.ToErrorResponse(err).Code != notFoundCode {
+	for i, b := range m.backends {
+		t, err := b.stat(ctx, path)
+		if err != nil {
+			if errors.Is(err, errNotExist) {
+				continue
+			}
 			errs = multierror.Append(errs, err)
 			continue
 		}
-		if minio.ToErrorResponse(err).Code == notFoundCode {
-			continue
+		results = append(results, statResult{index: i, modTime: t})
+		if t.After(modTime) {
+			modTime = t
 		}
+	}
 
-		if objInfo.LastModified.After(modTime) {
-			modTime = objInfo.LastModified
-			bucketIndex = i
-			checkedOne = true
+	if len(results) == 0 {
+		if errs != nil {
+			return time.Time{}, 0, errs
 		}
+		return time.Time{}, 0, fmt.Errorf("no file has been modified so either they do not exist or there are time synchronization problems")
 	}
 
-	if !checkedOne {
-		if errs != nil {
-			return modTime, bucketIndex, errs
+	var tied []int
+	for _, r := range results {
+		if r.modTime.Equal(modTime) {
+			tied = append(tied, r.index)
 		}
-		return modTime, bucketIndex, fmt.Errorf("no file has been modified so either they do not exist or there are time synchronization problems")
 	}
-	return
+
+	if len(tied) > 1 {
+		digests, divergent, err := m.checksumDivergence(ctx, path, tied)
+		if err != nil {
+			return modTime, 0, err
+		}
+		if divergent {
+			return modTime, 0, &ChecksumDivergenceError{Path: path, ModTime: modTime, BucketIndices: tied, Digests: digests}
+		}
+	}
+
+	return modTime, tied[0], nil
 }
 
 // FindNewestInPrefix finds the newest file in all of the buckets for the provided prefix.
 // Returns the modification time and bucket index that later on needs to be passed to GetFiles.
 func (m *BucketManager) FindNewestInPrefix(ctx context.Context, prefix string) (modTime time.Time, bucketIndex int, err error) {
-	if len(m.clients) == 0 {
+	if len(m.backends) == 0 {
 		return modTime, bucketIndex, fmt.Errorf("no clients configured")
 	}
 
-	const notFoundCode = "NoSuchKey"
+	if !strings.HasSuffix(prefix, "/") {
+		prefix = prefix + "/"
+	}
 
 	var (
 		errs       error
 		checkedOne bool
 	)
 
-	if !strings.HasSuffix(prefix, "/") {
-		prefix = prefix + "/"
-	}
-
-	for i, cl := range m.clients {
-		objCh := cl.ListObjects(ctx, m.bucketNames[i], minio.ListObjectsOptions{Prefix: prefix})
-		for objInfo := range objCh {
-			err := objInfo.Err
-			if err != nil && minio.ToErrorResponse(err).Code != notFoundCode {
-				errs = multierror.Append(errs, err)
-				continue
-			}
-			if minio.ToErrorResponse(err).Code == notFoundCode {
-				continue
-			}
+	for i, b := range m.backends {
+		objs, err := b.list(ctx, prefix)
+		if err != nil {
+			errs = multierror.Append(errs, err)
+			continue
+		}
 
-			if objInfo.LastModified.After(modTime) {
-				modTime = objInfo.LastModified
+		for _, obj := range objs {
+			if obj.LastModified.After(modTime) {
+				modTime = obj.LastModified
 				bucketIndex = i
 				checkedOne = true
 			}
@@ -224,44 +663,52 @@ func (m *BucketManager) FindNewestInPrefix(ctx context.Context, prefix string) (
 	return
 }
 
-type hostHeaderAddRoundtripper struct {
-	rt                   http.RoundTripper
-	customHostHeader     string
-	accessKey, secretKey string
-}
+// FindNewestByPrefix lists every object under prefix in every bucket and
+// returns the key, modification time and bucket index of the single newest
+// object found. This is for deploy setups that name each artifact with an
+// immutable, sortable-by-time key (e.g. "myapp/2024-11-07T12:00:00Z.tar.gz")
+// instead of publishing to a mutable path -- the installer always wants
+// "latest under this prefix" without the publisher needing a second step to
+// update a pointer.
+func (m *BucketManager) FindNewestByPrefix(ctx context.Context, prefix string) (key string, modTime time.Time, bucketIndex int, err error) {
+	if len(m.backends) == 0 {
+		return "", modTime, 0, fmt.Errorf("no clients configured")
+	}
 
-func (rt *hostHeaderAddRoundtripper) RoundTrip(req *http.Request) (*http.Response, error) {
-	if rt.customHostHeader == "" {
-		return rt.rt.RoundTrip(req)
+	if !strings.HasSuffix(prefix, "/") {
+		prefix = prefix + "/"
 	}
-	req.Host = rt.customHostHeader
-	req = signer.SignV4(*req, rt.accessKey, rt.secretKey, "", "")
-	return rt.rt.RoundTrip(req)
-}
 
-func NewBucketManager(buckets []cfg.BucketConfig) (*BucketManager, error) {
-	clients := make([]*minio.Client, 0, len(buckets))
-	bucketNames := make([]string, 0, len(buckets))
-	for _, bkt := range buckets {
-		client, err := minio.New(bkt.Host, &minio.Options{
-			Creds:        credentials.NewStaticV4(string(bkt.AccessKey), string(bkt.SecretKey), ""),
-			Secure:       false,
-			BucketLookup: minio.BucketLookupPath,
-			Transport: &hostHeaderAddRoundtripper{
-				customHostHeader: bkt.CustomHostHeader,
-				rt:               http.DefaultTransport,
-				accessKey:        string(bkt.AccessKey),
-				secretKey:        string(bkt.SecretKey),
-			},
-		})
+	var (
+		errs       error
+		checkedOne bool
+	)
+
+	for i, b := range m.backends {
+		objs, err := b.list(ctx, prefix)
 		if err != nil {
-			return nil, fmt.Errorf("creating client for %s: %w", bkt.Host, err)
+			errs = multierror.Append(errs, err)
+			continue
+		}
+
+		for _, obj := range objs {
+			if obj.Key == prefix {
+				continue // not a file: prefix (directory)
+			}
+			if obj.LastModified.After(modTime) {
+				modTime = obj.LastModified
+				key = obj.Key
+				bucketIndex = i
+				checkedOne = true
+			}
 		}
-		clients = append(clients, client)
-		bucketNames = append(bucketNames, bkt.Bucket)
 	}
-	return &BucketManager{
-		clients:     clients,
-		bucketNames: bucketNames,
-	}, nil
+
+	if !checkedOne {
+		if errs != nil {
+			return "", modTime, bucketIndex, errs
+		}
+		return "", modTime, bucketIndex, fmt.Errorf("no objects found under prefix %s", prefix)
+	}
+	return key, modTime, bucketIndex, nil
 }
@@ -2,26 +2,38 @@ package downloader_test
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
-	"github.com/go-kit/log"
 	"github.com/johannesboyne/gofakes3"
 	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/vinted/S3Grabber/internal/cfg"
 	"github.com/vinted/S3Grabber/internal/downloader"
 	"github.com/vinted/S3Grabber/internal/installer"
+	"gopkg.in/yaml.v3"
 )
 
 func TestDownloadFile(t *testing.T) {
 	t.Run("negative tests", func(t *testing.T) {
-		bm, err := downloader.NewBucketManager([]cfg.BucketConfig{})
+		bm, err := downloader.NewBucketManager(context.Background(), []cfg.BucketConfig{}, cfg.DownloadLimits{}, nil, nil)
 		assert.Nil(t, err)
 
 		rc, err := bm.GetFile(context.Background(), "/test/a", -1)
@@ -42,7 +54,7 @@ func TestDownloadFile(t *testing.T) {
 		ts2 := httptest.NewServer(faker2.Server())
 		t.Cleanup(ts2.Close)
 
-		bm, err := downloader.NewBucketManager([]cfg.BucketConfig{
+		bm, err := downloader.NewBucketManager(context.Background(), []cfg.BucketConfig{
 			{
 				Host:      strings.TrimPrefix(ts1.URL, "http://"),
 				AccessKey: "something",
@@ -55,7 +67,7 @@ func TestDownloadFile(t *testing.T) {
 				SecretKey: "something",
 				Bucket:    "coolbucket",
 			},
-		})
+		}, cfg.DownloadLimits{}, nil, nil)
 		assert.Nil(t, err)
 
 		// Upload the same file to both buckets.
@@ -77,7 +89,7 @@ func TestDownloadFile(t *testing.T) {
 		})
 		assert.Nil(t, os.MkdirAll(tmpDir, os.ModePerm))
 
-		assert.Nil(t, installer.ExtractTarGz(log.NewNopLogger(), "foo", tmpDir, rc))
+		assert.Nil(t, installer.ExtractTarGz(slog.New(slog.NewTextHandler(io.Discard, nil)), "foo", tmpDir, nil, nil, rc))
 		f, err := os.Open(filepath.Join(tmpDir, "test"))
 		assert.Nil(t, err)
 		t.Cleanup(func() {
@@ -102,3 +114,624 @@ func TestDownloadFile(t *testing.T) {
 		assert.NotEqual(t, modTime1, modTime2)
 	})
 }
+
+func TestDownloadFile_FilesystemBackend(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "example.tar.gz"), []byte("not really a tarball"), 0644))
+
+	bm, err := downloader.NewBucketManager(context.Background(), []cfg.BucketConfig{
+		{
+			Type: "filesystem",
+			Config: mustYAMLNode(t, map[string]string{
+				"path": root,
+			}),
+		},
+	}, cfg.DownloadLimits{}, nil, nil)
+	require.NoError(t, err)
+
+	modTime, bi, err := bm.FindNewestFile(context.Background(), "example.tar.gz")
+	require.NoError(t, err)
+	assert.Equal(t, 0, bi)
+	assert.WithinDuration(t, time.Now(), modTime, time.Minute)
+
+	rc, err := bm.GetFile(context.Background(), "example.tar.gz", bi)
+	require.NoError(t, err)
+	defer rc.Close()
+
+	content, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "not really a tarball", string(content))
+}
+
+func TestGetFiles_ConcurrencyAndRateLimit(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 5; i++ {
+		name := filepath.Join(root, "files", fmt.Sprintf("file%d.txt", i))
+		require.NoError(t, os.MkdirAll(filepath.Dir(name), os.ModePerm))
+		require.NoError(t, os.WriteFile(name, []byte("hello"), 0644))
+	}
+
+	bm, err := downloader.NewBucketManager(context.Background(), []cfg.BucketConfig{
+		{
+			Type: "filesystem",
+			Config: mustYAMLNode(t, map[string]string{
+				"path": root,
+			}),
+		},
+	}, cfg.DownloadLimits{MaxConcurrentDownloads: 2, BytesPerSecond: 1024}, nil, nil)
+	require.NoError(t, err)
+
+	filesCh, err := bm.GetFiles(context.Background(), "files", 0)
+	require.NoError(t, err)
+
+	got := map[string]string{}
+	for f := range filesCh {
+		require.NoError(t, f.Err)
+		content, err := io.ReadAll(f.Content)
+		require.NoError(t, err)
+		require.NoError(t, f.Content.Close())
+		got[f.Key] = string(content)
+	}
+
+	assert.Len(t, got, 5)
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, "hello", got[fmt.Sprintf("file%d.txt", i)])
+	}
+}
+
+// slowGET wraps h so that every GET request is delayed by d, simulating a
+// replica with poor latency.
+func slowGET(h http.Handler, d time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			time.Sleep(d)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func TestGetFileHedged(t *testing.T) {
+	t.Run("fastest replica wins", func(t *testing.T) {
+		fastBackend, slowBackend := s3mem.New(), s3mem.New()
+		fastFaker := gofakes3.New(fastBackend)
+		slowFaker := gofakes3.New(slowBackend)
+
+		tsFast := httptest.NewServer(fastFaker.Server())
+		t.Cleanup(tsFast.Close)
+		tsSlow := httptest.NewServer(slowGET(slowFaker.Server(), 500*time.Millisecond))
+		t.Cleanup(tsSlow.Close)
+
+		bm, err := downloader.NewBucketManager(context.Background(), []cfg.BucketConfig{
+			{
+				Host:      strings.TrimPrefix(tsFast.URL, "http://"),
+				AccessKey: "something",
+				SecretKey: "something",
+				Bucket:    "coolbucket",
+				Hedge:     cfg.HedgeConfig{Skew: 5 * time.Second},
+			},
+			{
+				Host:      strings.TrimPrefix(tsSlow.URL, "http://"),
+				AccessKey: "something",
+				SecretKey: "something",
+				Bucket:    "coolbucket",
+				Hedge:     cfg.HedgeConfig{Skew: 5 * time.Second},
+			},
+		}, cfg.DownloadLimits{}, nil, nil)
+		require.NoError(t, err)
+
+		require.NoError(t, bm.CreateBucket(context.Background(), "coolbucket", 0))
+		require.NoError(t, bm.CreateBucket(context.Background(), "coolbucket", 1))
+		require.NoError(t, bm.PutFile(context.Background(), "./example.tar.gz", "/example.tar.gz", 0))
+		require.NoError(t, bm.PutFile(context.Background(), "./example.tar.gz", "/example.tar.gz", 1))
+
+		start := time.Now()
+		rc, err := bm.GetFileHedged(context.Background(), "/example.tar.gz")
+		require.NoError(t, err)
+		defer rc.Close()
+
+		// The slow replica sleeps 500ms before answering; if the race had
+		// waited for it instead of returning the fast replica, this would
+		// take at least that long.
+		assert.Less(t, time.Since(start), 400*time.Millisecond)
+
+		content, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		want, err := os.ReadFile("./example.tar.gz")
+		require.NoError(t, err)
+		assert.Equal(t, want, content)
+	})
+
+	t.Run("no replica has the object", func(t *testing.T) {
+		bm, err := downloader.NewBucketManager(context.Background(), []cfg.BucketConfig{}, cfg.DownloadLimits{}, nil, nil)
+		require.NoError(t, err)
+
+		rc, err := bm.GetFileHedged(context.Background(), "/missing")
+		assert.Nil(t, rc)
+		assert.Error(t, err)
+	})
+}
+
+func TestGetFileParallel(t *testing.T) {
+	backend1 := s3mem.New()
+	faker1 := gofakes3.New(backend1)
+	ts1 := httptest.NewServer(faker1.Server())
+	t.Cleanup(ts1.Close)
+
+	bm, err := downloader.NewBucketManager(context.Background(), []cfg.BucketConfig{
+		{
+			Host:      strings.TrimPrefix(ts1.URL, "http://"),
+			AccessKey: "something",
+			SecretKey: "something",
+			Bucket:    "coolbucket",
+		},
+	}, cfg.DownloadLimits{PartSize: 256 * 1024, PartConcurrency: 4}, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, bm.CreateBucket(context.Background(), "coolbucket", 0))
+
+	// Large enough to need several parts at the 256 KiB PartSize configured
+	// above.
+	want := make([]byte, 3*1024*1024+777)
+	rand.New(rand.NewSource(1)).Read(want)
+
+	artifact := filepath.Join(t.TempDir(), "artifact.bin")
+	require.NoError(t, os.WriteFile(artifact, want, 0644))
+	require.NoError(t, bm.PutFile(context.Background(), artifact, "/artifact.bin", 0))
+
+	rc, err := bm.GetFileParallel(context.Background(), "/artifact.bin", 0)
+	require.NoError(t, err)
+	defer rc.Close()
+
+	got, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, want, got, "GetFileParallel must reassemble parts in order, matching a non-parallel GetFile")
+
+	baseline, err := bm.GetFile(context.Background(), "/artifact.bin", 0)
+	require.NoError(t, err)
+	defer baseline.Close()
+	baselineContent, err := io.ReadAll(baseline)
+	require.NoError(t, err)
+	assert.Equal(t, baselineContent, got)
+}
+
+// failRangeTransport fails exactly the GET request whose Range header
+// matches failRange, forwarding everything else to rt unchanged. It
+// responds 403 rather than 500 so minio-go treats the failure as
+// non-retryable and the test doesn't pay for its internal retry backoff.
+type failRangeTransport struct {
+	rt        http.RoundTripper
+	failRange string
+}
+
+func (t *failRangeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodGet && req.Header.Get("Range") == t.failRange {
+		return &http.Response{
+			StatusCode: http.StatusForbidden,
+			Status:     "403 Forbidden",
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     make(http.Header),
+			Body:       io.NopCloser(strings.NewReader("boom")),
+			Request:    req,
+		}, nil
+	}
+	return t.rt.RoundTrip(req)
+}
+
+// TestGetFileParallel_PartErrorClosesSiblingReaders covers the resource leak
+// in the assembler goroutine: when one part fails, every other part whose
+// fetch already completed successfully must still be closed, not left for
+// the garbage collector. A part's reader here is a *minio.Object, which
+// keeps an internal goroutine running (blocked on its request channel)
+// until Close is called -- so a leaked reader shows up as a leaked
+// goroutine.
+func TestGetFileParallel_PartErrorClosesSiblingReaders(t *testing.T) {
+	backend := s3mem.New()
+	faker := gofakes3.New(backend)
+	ts := httptest.NewServer(faker.Server())
+	t.Cleanup(ts.Close)
+
+	const partSize = 64 * 1024
+	failRange := fmt.Sprintf("bytes=0-%d", partSize-1)
+
+	origTransport := http.DefaultTransport
+	http.DefaultTransport = &failRangeTransport{rt: origTransport, failRange: failRange}
+	t.Cleanup(func() { http.DefaultTransport = origTransport })
+
+	bm, err := downloader.NewBucketManager(context.Background(), []cfg.BucketConfig{
+		{
+			Host:      strings.TrimPrefix(ts.URL, "http://"),
+			AccessKey: "something",
+			SecretKey: "something",
+			Bucket:    "coolbucket",
+		},
+	}, cfg.DownloadLimits{PartSize: partSize, PartConcurrency: 2}, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, bm.CreateBucket(context.Background(), "coolbucket", 0))
+
+	// Exactly two parts: the first is the one failRangeTransport breaks, the
+	// second completes normally and is the one that must still get closed.
+	want := make([]byte, 2*partSize)
+	rand.New(rand.NewSource(3)).Read(want)
+	artifact := filepath.Join(t.TempDir(), "big.bin")
+	require.NoError(t, os.WriteFile(artifact, want, 0644))
+	require.NoError(t, bm.PutFile(context.Background(), artifact, "/big.bin", 0))
+
+	before := runtime.NumGoroutine()
+
+	rc, err := bm.GetFileParallel(context.Background(), "/big.bin", 0)
+	require.NoError(t, err)
+
+	_, err = io.ReadAll(rc)
+	require.Error(t, err)
+	rc.Close()
+
+	require.Eventually(t, func() bool {
+		// +1: Eventually itself runs this condition on its own goroutine,
+		// which is still alive while NumGoroutine is read.
+		return runtime.NumGoroutine() <= before+1
+	}, time.Second, 10*time.Millisecond, "goroutine count did not return to baseline -- a sibling part's reader was left unclosed")
+}
+
+// TestS3Backend_Addressing exercises both bucket addressing modes --
+// path-style ("host/bucket", the long-standing default) and virtual-hosted
+// ("bucket.host", required by some modern S3-compatible providers) -- end to
+// end against gofakes3.
+func TestS3Backend_Addressing(t *testing.T) {
+	t.Run("path-style", func(t *testing.T) {
+		testS3Addressing(t, false)
+	})
+	t.Run("virtual-hosted", func(t *testing.T) {
+		testS3Addressing(t, true)
+	})
+}
+
+func testS3Addressing(t *testing.T, useVirtualHosted bool) {
+	var opts []gofakes3.Option
+	if useVirtualHosted {
+		opts = append(opts, gofakes3.WithHostBucket(true))
+	}
+	faker := gofakes3.New(s3mem.New(), opts...)
+	ts := httptest.NewServer(faker.Server())
+	t.Cleanup(ts.Close)
+
+	if useVirtualHosted {
+		// ts.URL is a bare IP:port, so "bucket.host"-style addresses it
+		// forms (e.g. "coolbucket.127.0.0.1:PORT") don't resolve via real
+		// DNS. Redirect every dial straight at the real listener instead --
+		// the only thing being exercised here is that the client forms and
+		// sends virtual-hosted-style requests, not that they survive a real
+		// DNS lookup.
+		realAddr := strings.TrimPrefix(ts.URL, "http://")
+		origTransport := http.DefaultTransport
+		http.DefaultTransport = &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, realAddr)
+			},
+		}
+		t.Cleanup(func() { http.DefaultTransport = origTransport })
+	}
+
+	bm, err := downloader.NewBucketManager(context.Background(), []cfg.BucketConfig{
+		{
+			Host:             strings.TrimPrefix(ts.URL, "http://"),
+			AccessKey:        "something",
+			SecretKey:        "something",
+			Bucket:           "coolbucket",
+			SignatureVersion: "v4",
+			UseVirtualHosted: useVirtualHosted,
+		},
+	}, cfg.DownloadLimits{}, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, bm.CreateBucket(context.Background(), "coolbucket", 0))
+
+	src := filepath.Join(t.TempDir(), "file.txt")
+	require.NoError(t, os.WriteFile(src, []byte("hello addressing"), 0644))
+	require.NoError(t, bm.PutFile(context.Background(), src, "/file.txt", 0))
+
+	rc, err := bm.GetFile(context.Background(), "/file.txt", 0)
+	require.NoError(t, err)
+	defer rc.Close()
+
+	content, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "hello addressing", string(content))
+}
+
+// TestS3Backend_CustomHostHeaderSignatureVersion covers the
+// CustomHostHeader+v2 combination (e.g. a bucket reached through a proxy
+// that still expects the request signed for the real S3 host): it must be
+// re-signed with SignV2, not silently upgraded to v4.
+func TestS3Backend_CustomHostHeaderSignatureVersion(t *testing.T) {
+	var gotAuth string
+	faker := gofakes3.New(s3mem.New())
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if gotAuth == "" {
+			gotAuth = r.Header.Get("Authorization")
+		}
+		faker.Server().ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+
+	realHost := strings.TrimPrefix(ts.URL, "http://")
+	bm, err := downloader.NewBucketManager(context.Background(), []cfg.BucketConfig{
+		{
+			Host:             realHost,
+			AccessKey:        "something",
+			SecretKey:        "something",
+			Bucket:           "coolbucket",
+			SignatureVersion: "v2",
+			CustomHostHeader: realHost,
+		},
+	}, cfg.DownloadLimits{}, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, bm.CreateBucket(context.Background(), "coolbucket", 0))
+
+	require.NotEmpty(t, gotAuth)
+	assert.True(t, strings.HasPrefix(gotAuth, "AWS "), "expected a v2-signed request, got Authorization=%q", gotAuth)
+	assert.False(t, strings.HasPrefix(gotAuth, "AWS4-HMAC-SHA256"), "CustomHostHeader must not force v4 signing over a configured v2 bucket, got Authorization=%q", gotAuth)
+}
+
+func newFSChecksumManager(t *testing.T, root string, checksumSidecar, strict bool) *downloader.BucketManager {
+	t.Helper()
+	bm, err := downloader.NewBucketManager(context.Background(), []cfg.BucketConfig{
+		{
+			Type: "filesystem",
+			Config: mustYAMLNode(t, map[string]string{
+				"path": root,
+			}),
+			ChecksumSidecar: checksumSidecar,
+			StrictChecksum:  strict,
+		},
+	}, cfg.DownloadLimits{}, nil, nil)
+	require.NoError(t, err)
+	return bm
+}
+
+func TestGetFile_ChecksumSidecar(t *testing.T) {
+	t.Run("happy path", func(t *testing.T) {
+		root := t.TempDir()
+		bm := newFSChecksumManager(t, root, true, false)
+
+		src := filepath.Join(t.TempDir(), "payload.bin")
+		require.NoError(t, os.WriteFile(src, []byte("hello checksum"), 0644))
+		require.NoError(t, bm.PutFile(context.Background(), src, "payload.bin", 0))
+		assert.FileExists(t, filepath.Join(root, "payload.bin.sha256"))
+
+		rc, err := bm.GetFile(context.Background(), "payload.bin", 0)
+		require.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		assert.Equal(t, "hello checksum", string(content))
+	})
+
+	t.Run("tampered object is rejected", func(t *testing.T) {
+		root := t.TempDir()
+		bm := newFSChecksumManager(t, root, true, false)
+
+		src := filepath.Join(t.TempDir(), "payload.bin")
+		require.NoError(t, os.WriteFile(src, []byte("hello checksum"), 0644))
+		require.NoError(t, bm.PutFile(context.Background(), src, "payload.bin", 0))
+
+		// Simulate a corrupted/poisoned replica by rewriting the object
+		// without touching its sidecar.
+		require.NoError(t, os.WriteFile(filepath.Join(root, "payload.bin"), []byte("tampered content"), 0644))
+
+		rc, err := bm.GetFile(context.Background(), "payload.bin", 0)
+		require.NoError(t, err)
+		_, err = io.ReadAll(rc)
+		require.Error(t, err)
+		assert.ErrorIs(t, err, downloader.ErrChecksumMismatch)
+	})
+
+	t.Run("missing sidecar is lax by default", func(t *testing.T) {
+		root := t.TempDir()
+		bm := newFSChecksumManager(t, root, true, false)
+
+		require.NoError(t, os.WriteFile(filepath.Join(root, "payload.bin"), []byte("no sidecar here"), 0644))
+
+		rc, err := bm.GetFile(context.Background(), "payload.bin", 0)
+		require.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		assert.Equal(t, "no sidecar here", string(content))
+	})
+
+	t.Run("missing sidecar fails in strict mode", func(t *testing.T) {
+		root := t.TempDir()
+		bm := newFSChecksumManager(t, root, true, true)
+
+		require.NoError(t, os.WriteFile(filepath.Join(root, "payload.bin"), []byte("no sidecar here"), 0644))
+
+		_, err := bm.GetFile(context.Background(), "payload.bin", 0)
+		require.Error(t, err)
+		assert.ErrorIs(t, err, downloader.ErrChecksumSidecarMissing)
+	})
+}
+
+func TestFindNewestFile_ChecksumDivergence(t *testing.T) {
+	rootA, rootB := t.TempDir(), t.TempDir()
+	bm, err := downloader.NewBucketManager(context.Background(), []cfg.BucketConfig{
+		{
+			Type:            "filesystem",
+			Config:          mustYAMLNode(t, map[string]string{"path": rootA}),
+			ChecksumSidecar: true,
+		},
+		{
+			Type:            "filesystem",
+			Config:          mustYAMLNode(t, map[string]string{"path": rootB}),
+			ChecksumSidecar: true,
+		},
+	}, cfg.DownloadLimits{}, nil, nil)
+	require.NoError(t, err)
+
+	// Same modTime, different content -- simulates two replicas of the
+	// "same" upload that have silently diverged.
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, os.WriteFile(filepath.Join(rootA, "payload.bin"), []byte("replica A"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(rootB, "payload.bin"), []byte("replica B"), 0644))
+	require.NoError(t, os.Chtimes(filepath.Join(rootA, "payload.bin"), modTime, modTime))
+	require.NoError(t, os.Chtimes(filepath.Join(rootB, "payload.bin"), modTime, modTime))
+
+	require.NoError(t, os.WriteFile(filepath.Join(rootA, "payload.bin.sha256"), []byte(sha256Sidecar("replica A")), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(rootB, "payload.bin.sha256"), []byte(sha256Sidecar("replica B")), 0644))
+
+	_, _, err = bm.FindNewestFile(context.Background(), "payload.bin")
+	require.Error(t, err)
+	var divergenceErr *downloader.ChecksumDivergenceError
+	require.ErrorAs(t, err, &divergenceErr)
+	assert.ElementsMatch(t, []int{0, 1}, divergenceErr.BucketIndices)
+}
+
+// sha256Sidecar returns the sidecar content PutFile would have written for
+// content, for tests that plant files directly rather than via PutFile.
+func sha256Sidecar(content string) string {
+	h := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(h[:]) + "\n"
+}
+
+// failFirstNGETs wraps h so that the first n GET requests fail with a 503,
+// simulating a backend that's transiently unavailable before recovering.
+func failFirstNGETs(h http.Handler, n int) http.Handler {
+	var seen int32
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && atomic.AddInt32(&seen, 1) <= int32(n) {
+			http.Error(w, "simulated outage", http.StatusServiceUnavailable)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func TestGetFile_RetriesTransientFailures(t *testing.T) {
+	const failures = 2
+
+	faker := gofakes3.New(s3mem.New())
+	ts := httptest.NewServer(failFirstNGETs(faker.Server(), failures))
+	t.Cleanup(ts.Close)
+
+	reg := prometheus.NewRegistry()
+	metrics := downloader.NewMetrics(reg)
+
+	bm, err := downloader.NewBucketManager(context.Background(), []cfg.BucketConfig{
+		{
+			Host:      strings.TrimPrefix(ts.URL, "http://"),
+			AccessKey: "something",
+			SecretKey: "something",
+			Bucket:    "coolbucket",
+		},
+	}, cfg.DownloadLimits{
+		Retry: cfg.RetryStrategy{MaxAttempts: failures + 2, Min: 5 * time.Millisecond, Max: 20 * time.Millisecond},
+	}, metrics, nil)
+	require.NoError(t, err)
+	require.NoError(t, bm.CreateBucket(context.Background(), "coolbucket", 0))
+
+	src := filepath.Join(t.TempDir(), "file.txt")
+	require.NoError(t, os.WriteFile(src, []byte("hello retries"), 0644))
+	require.NoError(t, bm.PutFile(context.Background(), src, "/file.txt", 0))
+
+	rc, err := bm.GetFile(context.Background(), "/file.txt", 0)
+	require.NoError(t, err)
+	defer rc.Close()
+
+	content, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "hello retries", string(content))
+
+	attempts, err := testutil.GatherAndCount(reg, "retry_attempts_total")
+	require.NoError(t, err)
+	assert.Greater(t, attempts, 0)
+
+	got := sumCounterValue(t, reg, "retry_attempts_total", map[string]string{"operation": "get", "bucket": "coolbucket"})
+	assert.Equal(t, float64(failures+1), got, "GetFile should have needed exactly one more attempt than the configured number of failures")
+}
+
+// sumCounterValue reads metric name from reg and sums the value of every
+// sample whose labels are a superset of wantLabels.
+func sumCounterValue(t *testing.T, reg *prometheus.Registry, name string, wantLabels map[string]string) float64 {
+	t.Helper()
+	families, err := reg.Gather()
+	require.NoError(t, err)
+
+	var total float64
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			match := true
+			for k, v := range wantLabels {
+				if labels[k] != v {
+					match = false
+					break
+				}
+			}
+			if match {
+				total += m.GetCounter().GetValue()
+			}
+		}
+	}
+	return total
+}
+
+func TestFindNewestByPrefix(t *testing.T) {
+	backend1, backend2 := s3mem.New(), s3mem.New()
+	faker1, faker2 := gofakes3.New(backend1), gofakes3.New(backend2)
+
+	ts1 := httptest.NewServer(faker1.Server())
+	t.Cleanup(ts1.Close)
+	ts2 := httptest.NewServer(faker2.Server())
+	t.Cleanup(ts2.Close)
+
+	bm, err := downloader.NewBucketManager(context.Background(), []cfg.BucketConfig{
+		{
+			Host:      strings.TrimPrefix(ts1.URL, "http://"),
+			AccessKey: "something",
+			SecretKey: "something",
+			Bucket:    "coolbucket",
+		},
+		{
+			Host:      strings.TrimPrefix(ts2.URL, "http://"),
+			AccessKey: "something",
+			SecretKey: "something",
+			Bucket:    "coolbucket",
+		},
+	}, cfg.DownloadLimits{}, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, bm.CreateBucket(context.Background(), "coolbucket", 0))
+	require.NoError(t, bm.CreateBucket(context.Background(), "coolbucket", 1))
+
+	// Stagger uploads across both buckets so each has its own newest
+	// artifact under the prefix, with bucket 1 holding the globally newest.
+	require.NoError(t, bm.PutFile(context.Background(), "./example.tar.gz", "/myapp/2024-11-07T12:00:00Z.tar.gz", 0))
+	time.Sleep(1 * time.Second)
+	require.NoError(t, bm.PutFile(context.Background(), "./example.tar.gz", "/myapp/2024-11-07T13:00:00Z.tar.gz", 1))
+
+	key, modTime, bucketIndex, err := bm.FindNewestByPrefix(context.Background(), "/myapp")
+	require.NoError(t, err)
+	assert.Equal(t, "/myapp/2024-11-07T13:00:00Z.tar.gz", key)
+	assert.Equal(t, 1, bucketIndex)
+	assert.WithinDuration(t, time.Now(), modTime, time.Minute)
+
+	files, err := bm.ListFiles(context.Background(), "/myapp", 0)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "/myapp/2024-11-07T12:00:00Z.tar.gz", files[0].Key)
+	assert.Greater(t, files[0].Size, int64(0))
+
+	_, _, _, err = bm.FindNewestByPrefix(context.Background(), "/nothing-here")
+	assert.Error(t, err)
+}
+
+func mustYAMLNode(t *testing.T, v interface{}) yaml.Node {
+	t.Helper()
+	var node yaml.Node
+	require.NoError(t, node.Encode(v))
+	return node
+}
@@ -0,0 +1,130 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/vinted/S3Grabber/internal/cfg"
+)
+
+// filesystemBackend serves a bucket out of a local directory, treating it as
+// if it were an object store: Config.Path is the bucket root, and object
+// keys are slash-separated paths relative to it.
+type filesystemBackend struct {
+	root string
+}
+
+func newFilesystemBackend(bkt cfg.BucketConfig) (*filesystemBackend, error) {
+	var fsCfg cfg.FilesystemConfig
+	if err := decodeBackendConfig(bkt, &fsCfg); err != nil {
+		return nil, err
+	}
+	if fsCfg.Path == "" {
+		return nil, fmt.Errorf("filesystem bucket: config.path is required")
+	}
+	return &filesystemBackend{root: fsCfg.Path}, nil
+}
+
+func (b *filesystemBackend) resolve(key string) string {
+	return filepath.Join(b.root, filepath.FromSlash(key))
+}
+
+func (b *filesystemBackend) get(ctx context.Context, key string) (io.ReadCloser, error) {
+	f, err := os.Open(b.resolve(key))
+	if os.IsNotExist(err) {
+		return nil, errNotExist
+	} else if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (b *filesystemBackend) getRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	f, err := os.Open(b.resolve(key))
+	if os.IsNotExist(err) {
+		return nil, errNotExist
+	} else if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return readCloser{Reader: io.LimitReader(f, length), Closer: f}, nil
+}
+
+func (b *filesystemBackend) stat(ctx context.Context, key string) (time.Time, error) {
+	fi, err := os.Stat(b.resolve(key))
+	if os.IsNotExist(err) {
+		return time.Time{}, errNotExist
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
+func (b *filesystemBackend) size(ctx context.Context, key string) (int64, error) {
+	fi, err := os.Stat(b.resolve(key))
+	if os.IsNotExist(err) {
+		return 0, errNotExist
+	} else if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+func (b *filesystemBackend) list(ctx context.Context, prefix string) ([]objectInfo, error) {
+	root := b.resolve(prefix)
+
+	var objs []objectInfo
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(b.root, path)
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objs = append(objs, objectInfo{Key: filepath.ToSlash(rel), Size: info.Size(), LastModified: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return objs, nil
+}
+
+func (b *filesystemBackend) put(ctx context.Context, key string, content io.Reader) error {
+	dst := b.resolve(key)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, content)
+	return err
+}
+
+func (b *filesystemBackend) createBucket(ctx context.Context, name string) error {
+	return os.MkdirAll(b.root, 0755)
+}
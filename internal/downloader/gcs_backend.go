@@ -0,0 +1,119 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/vinted/S3Grabber/internal/cfg"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// gcsBackend serves a bucket from Google Cloud Storage.
+type gcsBackend struct {
+	client     *storage.Client
+	bucket     *storage.BucketHandle
+	bucketName string
+	projectID  string
+}
+
+func newGCSBackend(ctx context.Context, bkt cfg.BucketConfig) (*gcsBackend, error) {
+	var gcsCfg cfg.GCSConfig
+	if err := decodeBackendConfig(bkt, &gcsCfg); err != nil {
+		return nil, err
+	}
+
+	var opts []option.ClientOption
+	if gcsCfg.CredentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(gcsCfg.CredentialsFile))
+	}
+
+	client, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating GCS client: %w", err)
+	}
+
+	return &gcsBackend{
+		client:     client,
+		bucket:     client.Bucket(bkt.Bucket),
+		bucketName: bkt.Bucket,
+		projectID:  gcsCfg.ProjectID,
+	}, nil
+}
+
+func (b *gcsBackend) get(ctx context.Context, key string) (io.ReadCloser, error) {
+	r, err := b.bucket.Object(key).NewReader(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, errNotExist
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+func (b *gcsBackend) getRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	r, err := b.bucket.Object(key).NewRangeReader(ctx, offset, length)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, errNotExist
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+func (b *gcsBackend) stat(ctx context.Context, key string) (time.Time, error) {
+	attrs, err := b.bucket.Object(key).Attrs(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return time.Time{}, errNotExist
+		}
+		return time.Time{}, err
+	}
+	return attrs.Updated, nil
+}
+
+func (b *gcsBackend) size(ctx context.Context, key string) (int64, error) {
+	attrs, err := b.bucket.Object(key).Attrs(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return 0, errNotExist
+		}
+		return 0, err
+	}
+	return attrs.Size, nil
+}
+
+func (b *gcsBackend) list(ctx context.Context, prefix string) ([]objectInfo, error) {
+	var objs []objectInfo
+	it := b.bucket.Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, objectInfo{Key: attrs.Name, Size: attrs.Size, LastModified: attrs.Updated, ETag: attrs.Etag})
+	}
+	return objs, nil
+}
+
+func (b *gcsBackend) put(ctx context.Context, key string, content io.Reader) error {
+	w := b.bucket.Object(key).NewWriter(ctx)
+	if _, err := io.Copy(w, content); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (b *gcsBackend) createBucket(ctx context.Context, name string) error {
+	return b.client.Bucket(name).Create(ctx, b.projectID, nil)
+}
@@ -0,0 +1,146 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/vinted/S3Grabber/internal/cfg"
+)
+
+// httpBackend serves a bucket from a plain read-only HTTP artifact server:
+// get fetches Config.BaseURL+"/"+key, stat does the same via HEAD. It has no
+// way to enumerate objects, so it only supports single-key grabbers (those
+// with a File, not a Dir) -- list/put/createBucket all return an error.
+type httpBackend struct {
+	baseURL string
+	client  *http.Client
+}
+
+func newHTTPBackend(bkt cfg.BucketConfig) (*httpBackend, error) {
+	var httpCfg cfg.HTTPConfig
+	if err := decodeBackendConfig(bkt, &httpCfg); err != nil {
+		return nil, err
+	}
+	if httpCfg.BaseURL == "" {
+		return nil, fmt.Errorf("http bucket: config.base_url is required")
+	}
+	return &httpBackend{
+		baseURL: strings.TrimSuffix(httpCfg.BaseURL, "/"),
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (b *httpBackend) url(key string) string {
+	return b.baseURL + "/" + strings.TrimPrefix(key, "/")
+}
+
+func (b *httpBackend) get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.url(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, errNotExist
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fetching %s: unexpected status %s", b.url(key), resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func (b *httpBackend) getRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.url(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, errNotExist
+	}
+	if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fetching %s: unexpected status %s", b.url(key), resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func (b *httpBackend) stat(ctx context.Context, key string) (time.Time, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, b.url(key), nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return time.Time{}, errNotExist
+	}
+	if resp.StatusCode != http.StatusOK {
+		return time.Time{}, fmt.Errorf("statting %s: unexpected status %s", b.url(key), resp.Status)
+	}
+
+	lastModified := resp.Header.Get("Last-Modified")
+	if lastModified == "" {
+		// The server doesn't tell us when the object changed -- treat it as
+		// always-newest so a single-file grabber still installs it.
+		return time.Now(), nil
+	}
+	t, err := http.ParseTime(lastModified)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parsing Last-Modified for %s: %w", b.url(key), err)
+	}
+	return t, nil
+}
+
+func (b *httpBackend) size(ctx context.Context, key string) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, b.url(key), nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return 0, errNotExist
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("statting %s: unexpected status %s", b.url(key), resp.Status)
+	}
+	if resp.ContentLength < 0 {
+		return 0, fmt.Errorf("statting %s: server did not report Content-Length", b.url(key))
+	}
+	return resp.ContentLength, nil
+}
+
+func (b *httpBackend) list(ctx context.Context, prefix string) ([]objectInfo, error) {
+	return nil, fmt.Errorf("http bucket: listing a prefix is not supported, use a file (not dir) grabber")
+}
+
+func (b *httpBackend) put(ctx context.Context, key string, content io.Reader) error {
+	return fmt.Errorf("http bucket: read-only, put is not supported")
+}
+
+func (b *httpBackend) createBucket(ctx context.Context, name string) error {
+	return fmt.Errorf("http bucket: read-only, createBucket is not supported")
+}
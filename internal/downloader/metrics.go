@@ -0,0 +1,36 @@
+package downloader
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Metrics holds the Prometheus collectors shared across every BucketManager's
+// downloads. Construct one instance per process and pass it to every
+// NewBucketManager call so the gauges reflect activity across all grabbers.
+type Metrics struct {
+	activeDownloads    prometheus.Gauge
+	downloadBytesTotal prometheus.Counter
+
+	// retryAttemptsTotal counts every attempt (including the first) a
+	// retryBackend makes at a backend operation, labelled by the operation
+	// name ("get", "put", "stat", ...) and bucket name.
+	retryAttemptsTotal *prometheus.CounterVec
+}
+
+func NewMetrics(registerer prometheus.Registerer) *Metrics {
+	return &Metrics{
+		activeDownloads: promauto.With(registerer).NewGauge(prometheus.GaugeOpts{
+			Name: "active_downloads",
+			Help: "How many objects are currently being downloaded from buckets",
+		}),
+		downloadBytesTotal: promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+			Name: "download_bytes_total",
+			Help: "Total bytes read while downloading objects from buckets",
+		}),
+		retryAttemptsTotal: promauto.With(registerer).NewCounterVec(prometheus.CounterOpts{
+			Name: "retry_attempts_total",
+			Help: "How many attempts (including the first) were made at a bucket operation",
+		}, []string{"operation", "bucket"}),
+	}
+}
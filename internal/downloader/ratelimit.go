@@ -0,0 +1,97 @@
+package downloader
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// rateLimiter throttles reads to a maximum number of bytes per second using a
+// token bucket. It is shared by every concurrent download started through the
+// same BucketManager, so the limit applies to their combined throughput
+// rather than to each download individually.
+type rateLimiter struct {
+	bytesPerSecond int64
+
+	mu       sync.Mutex
+	tokens   int64
+	lastFill time.Time
+}
+
+func newRateLimiter(bytesPerSecond int64) *rateLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		bytesPerSecond: bytesPerSecond,
+		tokens:         bytesPerSecond,
+		lastFill:       time.Now(),
+	}
+}
+
+// waitN blocks until n bytes' worth of tokens are available, or ctx is done.
+func (r *rateLimiter) waitN(ctx context.Context, n int) error {
+	if r == nil {
+		return nil
+	}
+
+	for {
+		r.mu.Lock()
+		r.refillLocked()
+		// A single read larger than the whole bucket would otherwise never be
+		// let through, so let it drain the bucket instead of blocking forever.
+		if r.tokens >= int64(n) || int64(n) >= r.bytesPerSecond {
+			r.tokens -= int64(n)
+			r.mu.Unlock()
+			return nil
+		}
+		r.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func (r *rateLimiter) refillLocked() {
+	now := time.Now()
+	elapsed := now.Sub(r.lastFill)
+	r.lastFill = now
+
+	r.tokens += int64(elapsed.Seconds() * float64(r.bytesPerSecond))
+	if r.tokens > r.bytesPerSecond {
+		r.tokens = r.bytesPerSecond
+	}
+}
+
+// limitedReadCloser wraps a downloaded object's body to apply the shared rate
+// limit and report byte/activity metrics as it is consumed.
+type limitedReadCloser struct {
+	ctx     context.Context
+	rc      io.ReadCloser
+	limiter *rateLimiter
+	metrics *Metrics
+}
+
+func (r *limitedReadCloser) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	if n > 0 {
+		if werr := r.limiter.waitN(r.ctx, n); werr != nil {
+			return n, werr
+		}
+		if r.metrics != nil {
+			r.metrics.downloadBytesTotal.Add(float64(n))
+		}
+	}
+	return n, err
+}
+
+func (r *limitedReadCloser) Close() error {
+	if r.metrics != nil {
+		r.metrics.activeDownloads.Dec()
+	}
+	return r.rc.Close()
+}
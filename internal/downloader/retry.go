@@ -0,0 +1,182 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/vinted/S3Grabber/internal/cfg"
+)
+
+// retryBackend wraps another backend, retrying a failed call according to
+// strategy before giving up, in the spirit of goamz's aws.AttemptStrategy.
+// 4xx responses and anything classified non-retryable by isRetryable (see
+// below) are surfaced on the first failure.
+type retryBackend struct {
+	inner      backend
+	bucketName string
+	strategy   cfg.RetryStrategy
+	metrics    *Metrics
+	logger     *slog.Logger
+}
+
+// newRetryBackend wraps inner in retry logic per strategy. If strategy is
+// the zero value, the returned backend behaves exactly like inner -- every
+// call is attempted exactly once.
+func newRetryBackend(inner backend, bucketName string, strategy cfg.RetryStrategy, metrics *Metrics, logger *slog.Logger) backend {
+	return &retryBackend{inner: inner, bucketName: bucketName, strategy: strategy, metrics: metrics, logger: logger}
+}
+
+// retry runs attempt, retrying it per b.strategy while it keeps failing with
+// a retryable error, and returns the last error if it never succeeds.
+func (b *retryBackend) retry(ctx context.Context, operation string, attempt func() error) error {
+	var deadline time.Time
+	if b.strategy.Total > 0 {
+		deadline = time.Now().Add(b.strategy.Total)
+	}
+	backoff := b.strategy.Min
+	if backoff <= 0 {
+		backoff = 100 * time.Millisecond
+	}
+
+	for i := 1; ; i++ {
+		err := attempt()
+		if b.metrics != nil {
+			b.metrics.retryAttemptsTotal.WithLabelValues(operation, b.bucketName).Inc()
+		}
+		if err == nil {
+			return nil
+		}
+		if b.strategy.MaxAttempts <= 0 && b.strategy.Total <= 0 {
+			// No retry policy configured -- behave like inner directly.
+			return err
+		}
+		if !isRetryable(err) {
+			return err
+		}
+		if b.strategy.MaxAttempts > 0 && i >= b.strategy.MaxAttempts {
+			return err
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return err
+		}
+
+		wait := backoff
+		if b.strategy.Jitter {
+			wait = time.Duration(rand.Int63n(int64(backoff) + 1))
+		}
+		b.logger.Warn("retrying bucket operation", "operation", operation, "bucket", b.bucketName, "attempt", i, "backoff", wait, "err", err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		backoff *= 2
+		if b.strategy.Max > 0 && backoff > b.strategy.Max {
+			backoff = b.strategy.Max
+		}
+	}
+}
+
+// isRetryable reports whether err looks like a transient failure worth
+// retrying: a 5xx response, a timeout, or another temporary network error.
+// A 4xx response, errNotExist, or context.Canceled are never retryable --
+// the caller either made a bad request or is no longer waiting for one.
+func isRetryable(err error) bool {
+	if errors.Is(err, errNotExist) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	if resp := minio.ToErrorResponse(err); resp.StatusCode != 0 {
+		return resp.StatusCode >= 500
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	// The http backend surfaces a bare HTTP status in its error text rather
+	// than a structured error type. 5xx errors from the azure and gcs
+	// backends match none of these checks and are not retried.
+	return strings.Contains(err.Error(), "unexpected status 5")
+}
+
+func (b *retryBackend) get(ctx context.Context, key string) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	err := b.retry(ctx, "get", func() error {
+		var err error
+		rc, err = b.inner.get(ctx, key)
+		return err
+	})
+	return rc, err
+}
+
+func (b *retryBackend) getRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	err := b.retry(ctx, "getRange", func() error {
+		var err error
+		rc, err = b.inner.getRange(ctx, key, offset, length)
+		return err
+	})
+	return rc, err
+}
+
+func (b *retryBackend) stat(ctx context.Context, key string) (time.Time, error) {
+	var t time.Time
+	err := b.retry(ctx, "stat", func() error {
+		var err error
+		t, err = b.inner.stat(ctx, key)
+		return err
+	})
+	return t, err
+}
+
+func (b *retryBackend) size(ctx context.Context, key string) (int64, error) {
+	var n int64
+	err := b.retry(ctx, "size", func() error {
+		var err error
+		n, err = b.inner.size(ctx, key)
+		return err
+	})
+	return n, err
+}
+
+func (b *retryBackend) list(ctx context.Context, prefix string) ([]objectInfo, error) {
+	var objs []objectInfo
+	err := b.retry(ctx, "list", func() error {
+		var err error
+		objs, err = b.inner.list(ctx, prefix)
+		return err
+	})
+	return objs, err
+}
+
+func (b *retryBackend) put(ctx context.Context, key string, content io.Reader) error {
+	// A retried upload must replay the exact same bytes; only bother
+	// retrying if content can be rewound, since otherwise a retry would
+	// silently upload a truncated tail instead of the whole object.
+	seeker, seekable := content.(io.Seeker)
+	if !seekable {
+		return b.inner.put(ctx, key, content)
+	}
+	return b.retry(ctx, "put", func() error {
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		return b.inner.put(ctx, key, content)
+	})
+}
+
+func (b *retryBackend) createBucket(ctx context.Context, name string) error {
+	return b.retry(ctx, "createBucket", func() error {
+		return b.inner.createBucket(ctx, name)
+	})
+}
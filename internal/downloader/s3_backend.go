@@ -0,0 +1,189 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/signer"
+	"github.com/vinted/S3Grabber/internal/cfg"
+	"github.com/vinted/S3Grabber/internal/secrets"
+)
+
+const s3NotFoundCode = "NoSuchKey"
+
+type hostHeaderAddRoundtripper struct {
+	rt                   http.RoundTripper
+	customHostHeader     string
+	signatureVersion     string
+	useVirtualHosted     bool
+	accessKey, secretKey string
+}
+
+func (rt *hostHeaderAddRoundtripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if rt.customHostHeader == "" {
+		return rt.rt.RoundTrip(req)
+	}
+	req.Host = rt.customHostHeader
+	if rt.signatureVersion == "v2" {
+		req = signer.SignV2(*req, rt.accessKey, rt.secretKey, rt.useVirtualHosted)
+	} else {
+		req = signer.SignV4(*req, rt.accessKey, rt.secretKey, "", "")
+	}
+	return rt.rt.RoundTrip(req)
+}
+
+// resolveCredentials returns bkt's access key, secret key and session token,
+// either taken directly from bkt or, if bkt.CredentialsSource is set,
+// resolved fresh from the external store it points at. It is called once per
+// newS3Backend call, i.e. once per sync, so a rotated secret is picked up
+// without restarting S3Grabber.
+func resolveCredentials(ctx context.Context, bkt cfg.BucketConfig) (accessKey, secretKey, sessionToken string, err error) {
+	if bkt.CredentialsSource == nil {
+		return string(bkt.AccessKey), string(bkt.SecretKey), "", nil
+	}
+
+	source, err := secrets.NewSource(bkt.CredentialsSource)
+	if err != nil {
+		return "", "", "", fmt.Errorf("building credentials source for %s: %w", bkt.Bucket, err)
+	}
+
+	creds, err := source.Resolve(ctx)
+	if err != nil {
+		return "", "", "", fmt.Errorf("resolving credentials for %s: %w", bkt.Bucket, err)
+	}
+	return creds.AccessKey, creds.SecretKey, creds.SessionToken, nil
+}
+
+// credentialsFor builds the minio Credentials for the given
+// cfg.BucketConfig.SignatureVersion ("v2" or "v4", defaulting to "v4").
+func credentialsFor(signatureVersion, accessKey, secretKey, sessionToken string) *credentials.Credentials {
+	if signatureVersion == "v2" {
+		return credentials.NewStaticV2(accessKey, secretKey, sessionToken)
+	}
+	return credentials.NewStaticV4(accessKey, secretKey, sessionToken)
+}
+
+// s3Backend serves a bucket from any S3-compatible store via minio-go. It's
+// the default backend, and the only one that understands
+// CredentialsSource/CustomHostHeader.
+type s3Backend struct {
+	client     *minio.Client
+	bucketName string
+}
+
+func newS3Backend(ctx context.Context, bkt cfg.BucketConfig) (*s3Backend, error) {
+	accessKey, secretKey, sessionToken, err := resolveCredentials(ctx, bkt)
+	if err != nil {
+		return nil, err
+	}
+
+	bucketLookup := minio.BucketLookupPath
+	if bkt.UseVirtualHosted {
+		bucketLookup = minio.BucketLookupDNS
+	}
+
+	client, err := minio.New(bkt.Host, &minio.Options{
+		Creds:        credentialsFor(bkt.SignatureVersion, accessKey, secretKey, sessionToken),
+		Secure:       false,
+		Region:       bkt.Region,
+		BucketLookup: bucketLookup,
+		Transport: &hostHeaderAddRoundtripper{
+			customHostHeader: bkt.CustomHostHeader,
+			signatureVersion: bkt.SignatureVersion,
+			useVirtualHosted: bkt.UseVirtualHosted,
+			rt:               http.DefaultTransport,
+			accessKey:        accessKey,
+			secretKey:        secretKey,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating client for %s: %w", bkt.Host, err)
+	}
+
+	return &s3Backend{client: client, bucketName: bkt.Bucket}, nil
+}
+
+func (b *s3Backend) get(ctx context.Context, key string) (io.ReadCloser, error) {
+	obj, err := b.client.GetObject(ctx, b.bucketName, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// GetObject doesn't talk to the server until the first read, so force
+	// that now to surface a NoSuchKey error here rather than from the first
+	// Read call the caller makes.
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code == s3NotFoundCode {
+			return nil, errNotExist
+		}
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (b *s3Backend) getRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(offset, offset+length-1); err != nil {
+		return nil, fmt.Errorf("setting range %d-%d: %w", offset, offset+length-1, err)
+	}
+	obj, err := b.client.GetObject(ctx, b.bucketName, key, opts)
+	if err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (b *s3Backend) stat(ctx context.Context, key string) (time.Time, error) {
+	info, err := b.client.StatObject(ctx, b.bucketName, key, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == s3NotFoundCode {
+			return time.Time{}, errNotExist
+		}
+		return time.Time{}, err
+	}
+	return info.LastModified, nil
+}
+
+func (b *s3Backend) size(ctx context.Context, key string) (int64, error) {
+	info, err := b.client.StatObject(ctx, b.bucketName, key, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == s3NotFoundCode {
+			return 0, errNotExist
+		}
+		return 0, err
+	}
+	return info.Size, nil
+}
+
+func (b *s3Backend) list(ctx context.Context, prefix string) ([]objectInfo, error) {
+	var (
+		objs []objectInfo
+		errs error
+	)
+	for info := range b.client.ListObjects(ctx, b.bucketName, minio.ListObjectsOptions{Prefix: prefix}) {
+		if info.Err != nil {
+			if minio.ToErrorResponse(info.Err).Code == s3NotFoundCode {
+				continue
+			}
+			errs = multierror.Append(errs, info.Err)
+			continue
+		}
+		objs = append(objs, objectInfo{Key: info.Key, Size: info.Size, LastModified: info.LastModified, ETag: info.ETag})
+	}
+	return objs, errs
+}
+
+func (b *s3Backend) put(ctx context.Context, key string, content io.Reader) error {
+	_, err := b.client.PutObject(ctx, b.bucketName, key, content, -1, minio.PutObjectOptions{})
+	return err
+}
+
+func (b *s3Backend) createBucket(ctx context.Context, name string) error {
+	return b.client.MakeBucket(ctx, name, minio.MakeBucketOptions{})
+}
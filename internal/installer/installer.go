@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path"
@@ -15,48 +16,20 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/go-kit/log"
-	"github.com/go-kit/log/level"
 	cp "github.com/otiai10/copy"
+	"github.com/vinted/S3Grabber/internal/cfg"
 	"github.com/vinted/S3Grabber/internal/downloader"
 )
 
-func removeContents(dir string) error {
-	return removeContentsWithPrefix(dir, "")
-}
-
-// removeContentsWithPrefix removes all files in dir that match the given prefix.
-// If prefix is empty, all files are removed (equivalent to removeContents).
-// If prefix is specified, only files starting with that prefix are removed.
-func removeContentsWithPrefix(dir string, prefix string) error {
-	d, err := os.Open(dir)
-	if err != nil {
-		return fmt.Errorf("opening %s: %w", dir, err)
-	}
-	defer d.Close()
-	names, err := d.Readdirnames(-1)
-	if err != nil {
-		return err
-	}
-	for _, name := range names {
-		// If prefix is specified, only remove files matching the prefix
-		if prefix != "" && !filepath.HasPrefix(name, prefix) {
-			continue
-		}
-		fn := filepath.Join(dir, name)
-		err = os.RemoveAll(fn)
-		if err != nil {
-			return fmt.Errorf("removing %s: %w", fn, err)
-		}
-	}
-	return nil
-}
-
 // Adopted from
 // https://stackoverflow.com/questions/57639648/how-to-decompress-tar-gz-file-in-go.
-// Clears out dir before extracting. If replacePrefix is specified, only files
-// matching that prefix are removed from dir, allowing partial updates.
-func ExtractTarGz(l log.Logger, uniqueName string, dir string, replacePrefix string, gzipStream io.Reader) error {
+// Clears out dir before extracting. patterns selects which files in dir are
+// owned by this grabber and therefore safe to clear, and which archive
+// entries to skip extracting; a nil patterns owns everything, matching the
+// old "replace everything" default. If manifest is non-nil, every extracted
+// entry must be listed in it with a matching SHA-256 digest, or extraction
+// fails with ErrIntegrityFailure before dir is touched.
+func ExtractTarGz(l *slog.Logger, uniqueName string, dir string, patterns *Patterns, manifest *manifest, gzipStream io.Reader) error {
 	tmpDir, err := os.MkdirTemp("", uniqueName)
 	if err != nil {
 		return fmt.Errorf("creating temp dir: %w", err)
@@ -64,7 +37,7 @@ func ExtractTarGz(l log.Logger, uniqueName string, dir string, replacePrefix str
 
 	defer func() {
 		if err := os.RemoveAll(tmpDir); err != nil {
-			_ = level.Debug(l).Log("msg", "failed best effort clean up", "dir", tmpDir, "err", err)
+			l.Debug("failed best effort clean up", "dir", tmpDir, "err", err)
 		}
 	}()
 	uncompressedStream, err := gzip.NewReader(gzipStream)
@@ -85,6 +58,10 @@ func ExtractTarGz(l log.Logger, uniqueName string, dir string, replacePrefix str
 			return fmt.Errorf("reading tar: %w", err)
 		}
 
+		if patterns.protected(header.Name) {
+			continue
+		}
+
 		switch header.Typeflag {
 		case tar.TypeDir:
 			fPath := filepath.Join(tmpDir, header.Name)
@@ -98,7 +75,16 @@ func ExtractTarGz(l log.Logger, uniqueName string, dir string, replacePrefix str
 				return fmt.Errorf("creating file %s: %w", fPath, err)
 			}
 			defer outFile.Close()
-			if _, err := io.Copy(outFile, tarReader); err != nil {
+
+			var src io.Reader = tarReader
+			if manifest != nil {
+				want, ok := manifest.digest(header.Name)
+				if !ok {
+					return fmt.Errorf("%w: %s: not listed in manifest", ErrIntegrityFailure, header.Name)
+				}
+				src = newHashingReader(tarReader, header.Name, want)
+			}
+			if _, err := io.Copy(outFile, src); err != nil {
 				return fmt.Errorf("copying file %s: %w", fPath, err)
 			}
 
@@ -107,10 +93,9 @@ func ExtractTarGz(l log.Logger, uniqueName string, dir string, replacePrefix str
 		}
 	}
 
-	// Copy over from tmpDir.
-	// If replacePrefix is specified, only remove files matching that prefix.
-	// Otherwise, remove all files (default behavior).
-	if err := removeContentsWithPrefix(dir, replacePrefix); err != nil {
+	// Copy over from tmpDir, first clearing out whatever this grabber owns
+	// in dir so stale files from a previous install don't linger.
+	if err := removeOwnedContents(dir, patterns); err != nil {
 		return fmt.Errorf("clearing %s: %w", dir, err)
 	}
 
@@ -125,14 +110,15 @@ func ExtractTarGz(l log.Logger, uniqueName string, dir string, replacePrefix str
 
 // Installer extracts files and runs commands if needed.
 type Installer struct {
-	commands                []string
-	installInto             string
-	bucketPath              string
-	lastModTimeByObjectPath map[string]time.Time
+	commands         []string
+	rollbackCommands []string
+	installInto      string
+	bucketPath       string
+	retention        cfg.RetentionConfig
 
 	bm       *downloader.BucketManager
 	shellCmd string
-	logger   log.Logger
+	logger   *slog.Logger
 	timeout  time.Duration
 
 	extracter extracter
@@ -140,44 +126,67 @@ type Installer struct {
 
 type extracter interface {
 	findNewestFile(ctx context.Context) (lastUpdated time.Time, bucketIndex int, err error)
-	extractFiles(ctx context.Context, bucketIndex int) (bool, error)
+	// extractFiles downloads and extracts into targetDir, which may be a
+	// staging directory rather than the extracter's own installInto.
+	extractFiles(ctx context.Context, bucketIndex int, targetDir string) (bool, error)
 }
 
-func NewArchiveInstaller(name string, bm *downloader.BucketManager, commands []string, bucketPath, installInto string, shellCmd string, timeout time.Duration, replacePrefix string, logger log.Logger) *Installer {
+func NewArchiveInstaller(name string, bm *downloader.BucketManager, buckets []cfg.BucketConfig, commands, rollbackCommands []string, bucketPath, installInto string, shellCmd string, timeout time.Duration, keep, remove []string, retention cfg.RetentionConfig, verification *cfg.VerificationConfig, metrics *Metrics, logger *slog.Logger) (*Installer, error) {
+	patterns, err := NewPatterns(keep, remove)
+	if err != nil {
+		return nil, fmt.Errorf("grabber %s: %w", name, err)
+	}
+	verifiers, err := newBucketVerifiers(buckets)
+	if err != nil {
+		return nil, fmt.Errorf("grabber %s: %w", name, err)
+	}
 	extracter := &archiveExtracter{
-		bucketPath:    bucketPath,
-		bm:            bm,
-		logger:        logger,
-		name:          name,
-		installInto:   installInto,
-		replacePrefix: replacePrefix,
-	}
-	return newInstaller(name, bm, commands, bucketPath, installInto, shellCmd, timeout, logger, extracter)
+		bucketPath:   bucketPath,
+		bm:           bm,
+		logger:       logger,
+		name:         name,
+		patterns:     patterns,
+		verifiers:    verifiers,
+		verification: newArtifactVerifier(verification, metrics),
+	}
+	return newInstaller(name, bm, commands, rollbackCommands, bucketPath, installInto, shellCmd, timeout, retention, logger, extracter), nil
 }
 
-func NewDirectoryInstaller(name string, bm *downloader.BucketManager, commands []string, bucketPath, installInto string, shellCmd string, timeout time.Duration, replacePrefix string, logger log.Logger) *Installer {
+func NewDirectoryInstaller(name string, bm *downloader.BucketManager, buckets []cfg.BucketConfig, commands, rollbackCommands []string, bucketPath, installInto string, shellCmd string, timeout time.Duration, keep, remove []string, retention cfg.RetentionConfig, verification *cfg.VerificationConfig, metrics *Metrics, logger *slog.Logger) (*Installer, error) {
+	if verification != nil {
+		return nil, fmt.Errorf("grabber %s: verification is only supported for file grabbers, not directory grabbers", name)
+	}
+	patterns, err := NewPatterns(keep, remove)
+	if err != nil {
+		return nil, fmt.Errorf("grabber %s: %w", name, err)
+	}
+	verifiers, err := newBucketVerifiers(buckets)
+	if err != nil {
+		return nil, fmt.Errorf("grabber %s: %w", name, err)
+	}
 	extracter := &directoryExtracter{
-		bucketPrefix:  bucketPath,
-		bm:            bm,
-		logger:        logger,
-		name:          name,
-		installInto:   installInto,
-		replacePrefix: replacePrefix,
-	}
-	return newInstaller(name, bm, commands, bucketPath, installInto, shellCmd, timeout, logger, extracter)
+		bucketPrefix: bucketPath,
+		bm:           bm,
+		logger:       logger,
+		name:         name,
+		patterns:     patterns,
+		verifiers:    verifiers,
+	}
+	return newInstaller(name, bm, commands, rollbackCommands, bucketPath, installInto, shellCmd, timeout, retention, logger, extracter), nil
 }
 
-func newInstaller(name string, bm *downloader.BucketManager, commands []string, bucketPath, installInto string, shellCmd string, timeout time.Duration, logger log.Logger, extracter extracter) *Installer {
+func newInstaller(name string, bm *downloader.BucketManager, commands, rollbackCommands []string, bucketPath, installInto string, shellCmd string, timeout time.Duration, retention cfg.RetentionConfig, logger *slog.Logger, extracter extracter) *Installer {
 	return &Installer{
-		bm:                      bm,
-		lastModTimeByObjectPath: make(map[string]time.Time),
-		commands:                commands,
-		installInto:             installInto,
-		bucketPath:              bucketPath,
-		shellCmd:                shellCmd,
-		logger:                  logger,
-		timeout:                 timeout,
-		extracter:               extracter,
+		bm:               bm,
+		commands:         commands,
+		rollbackCommands: rollbackCommands,
+		installInto:      installInto,
+		bucketPath:       bucketPath,
+		retention:        retention,
+		shellCmd:         shellCmd,
+		logger:           logger,
+		timeout:          timeout,
+		extracter:        extracter,
 	}
 }
 
@@ -202,20 +211,20 @@ func IsEmptyDir(dir string) (bool, error) {
 func (i *Installer) Install(ctx context.Context) (attemptedInstall bool, rerr error) {
 	isEmpty, err := IsEmptyDir(i.installInto)
 	if err != nil {
-		_ = level.Debug(i.logger).Log("msg", "failed to check if dir is empty", "err", err.Error(), "dir", i.installInto)
+		i.logger.Debug("failed to check if dir is empty", "err", err, "dir", i.installInto)
 	}
 
 	doInstall := false
 	if isEmpty {
-		_ = level.Debug(i.logger).Log("msg", "executing installation because the provided dir is empty", "dir", i.installInto)
+		i.logger.Debug("executing installation because the provided dir is empty", "dir", i.installInto)
 		doInstall = true
 	}
 
-	bucketIndex, err := i.checkLastModTime(ctx, i.installInto)
+	mTm, bucketIndex, err := i.checkLastModTime(ctx)
 	if err != nil && !errors.Is(err, ErrNoUpdate) {
 		return false, err
 	} else if err == nil {
-		_ = level.Debug(i.logger).Log("msg", "executing installation because we have found an update", "dir", i.installInto, "path", i.bucketPath)
+		i.logger.Debug("executing installation because we have found an update", "dir", i.installInto, "path", i.bucketPath)
 		doInstall = true
 	}
 
@@ -223,88 +232,289 @@ func (i *Installer) Install(ctx context.Context) (attemptedInstall bool, rerr er
 		return false, nil
 	}
 
-	attempted, err := i.extracter.extractFiles(ctx, bucketIndex)
+	return i.installTransactionally(ctx, bucketIndex, mTm)
+}
+
+// installTransactionally extracts into a brand new generation directory
+// under .versions, then atomically points installInto's symlink at it (so
+// installInto is never observed half-written), and only then runs commands.
+// If a command fails or ctx is cancelled, it points the symlink back at the
+// previous generation and runs RollbackCommands, so a bad release never
+// leaves installInto pointing at a broken generation. On success, the new
+// generation is recorded and pruned per Retention.
+func (i *Installer) installTransactionally(ctx context.Context, bucketIndex int, mTm time.Time) (attemptedInstall bool, rerr error) {
+	meta, err := loadVersionsMeta(i.installInto)
+	if err != nil {
+		return false, fmt.Errorf("loading versions metadata: %w", err)
+	}
+	prevGeneration, hadPrevGeneration := meta.latest()
+
+	newGeneration := Generation{Timestamp: nextGenerationTimestamp(i.installInto), SourceModTime: mTm}
+	genDir := newGeneration.dir(i.installInto)
+	if err := i.seedGeneration(genDir, prevGeneration, hadPrevGeneration); err != nil {
+		return false, fmt.Errorf("seeding generation %s: %w", genDir, err)
+	}
+	defer func() {
+		if rerr != nil {
+			if err := os.RemoveAll(genDir); err != nil {
+				i.logger.Debug("failed best effort clean up", "dir", genDir, "err", err)
+			}
+		}
+	}()
+
+	attempted, err := i.extracter.extractFiles(ctx, bucketIndex, genDir)
 	if err != nil {
 		return attempted, fmt.Errorf("extracting files: %w", err)
 	}
 
-	// Execute each command one by one.
-	for _, cmd := range i.commands {
+	if err := swapSymlink(i.installInto, genDir); err != nil {
+		return attempted, fmt.Errorf("swapping in new generation: %w", err)
+	}
+
+	if err := i.runCommands(ctx, i.commands); err != nil {
+		if !hadPrevGeneration {
+			return true, fmt.Errorf("executing commands on first install, nothing to roll back to: %w", err)
+		}
+		if rbErr := i.rollback(ctx, prevGeneration.dir(i.installInto)); rbErr != nil {
+			return true, fmt.Errorf("executing commands: %w (rollback also failed: %s)", err, rbErr)
+		}
+		return true, fmt.Errorf("executing commands, rolled back to the previous generation: %w", err)
+	}
+
+	meta.Generations = append(meta.Generations, newGeneration)
+	if err := meta.prune(i.installInto, i.retention); err != nil {
+		return true, fmt.Errorf("pruning old generations: %w", err)
+	}
+	if err := meta.save(i.installInto); err != nil {
+		return true, fmt.Errorf("saving versions metadata: %w", err)
+	}
+
+	return true, nil
+}
+
+// seedGeneration populates genDir with the contents an extracter that only
+// clears the paths it owns (see Patterns) expects to build on: the previous
+// generation's contents, if one exists, or installInto itself if it is a
+// plain directory left over from before versioned installs existed (which
+// swapSymlink then reclaims). A brand new installInto starts genDir empty.
+func (i *Installer) seedGeneration(genDir string, prevGeneration Generation, hadPrevGeneration bool) error {
+	if err := os.MkdirAll(genDir, 0755); err != nil {
+		return fmt.Errorf("creating generation dir %s: %w", genDir, err)
+	}
+
+	if hadPrevGeneration {
+		return cp.Copy(prevGeneration.dir(i.installInto), genDir, cp.Options{
+			PermissionControl: cp.DoNothing,
+			Sync:              true,
+		})
+	}
+
+	fi, err := os.Lstat(i.installInto)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("calling lstat %s: %w", i.installInto, err)
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+
+	return cp.Copy(i.installInto, genDir, cp.Options{
+		PermissionControl: cp.DoNothing,
+		Sync:              true,
+	})
+}
+
+// swapSymlink atomically points installInto at genDir, replacing whatever it
+// pointed to before -- or the plain directory left over there from before
+// versioned installs existed, which seedGeneration already copied from.
+func swapSymlink(installInto, genDir string) error {
+	tmpSymlink := installInto + ".symlink-tmp"
+	if err := os.RemoveAll(tmpSymlink); err != nil {
+		return fmt.Errorf("clearing stale %s: %w", tmpSymlink, err)
+	}
+	if err := os.Symlink(genDir, tmpSymlink); err != nil {
+		return fmt.Errorf("creating symlink %s -> %s: %w", tmpSymlink, genDir, err)
+	}
+
+	if fi, err := os.Lstat(installInto); err == nil && fi.Mode()&os.ModeSymlink == 0 {
+		if err := os.RemoveAll(installInto); err != nil {
+			return fmt.Errorf("removing legacy directory %s: %w", installInto, err)
+		}
+	}
+
+	return os.Rename(tmpSymlink, installInto)
+}
+
+// rollback points installInto's symlink back at prevGenerationDir and runs
+// RollbackCommands.
+func (i *Installer) rollback(ctx context.Context, prevGenerationDir string) error {
+	if err := swapSymlink(i.installInto, prevGenerationDir); err != nil {
+		return fmt.Errorf("restoring previous generation: %w", err)
+	}
+	return i.runCommands(ctx, i.rollbackCommands)
+}
+
+// Rollback points installInto at the generation installed `steps` releases
+// ago, re-runs the post-install commands against it, and discards the
+// generations newer than the rollback target.
+func (i *Installer) Rollback(ctx context.Context, steps int) error {
+	if steps <= 0 {
+		return fmt.Errorf("steps must be positive, got %d", steps)
+	}
+
+	meta, err := loadVersionsMeta(i.installInto)
+	if err != nil {
+		return fmt.Errorf("loading versions metadata: %w", err)
+	}
+	if steps >= len(meta.Generations) {
+		return fmt.Errorf("only %d generation(s) available, cannot roll back %d step(s)", len(meta.Generations), steps)
+	}
+
+	target := meta.Generations[len(meta.Generations)-1-steps]
+	if err := swapSymlink(i.installInto, target.dir(i.installInto)); err != nil {
+		return fmt.Errorf("rolling back to generation %s: %w", target.Timestamp, err)
+	}
+	if err := i.runCommands(ctx, i.commands); err != nil {
+		return fmt.Errorf("executing commands after rollback: %w", err)
+	}
+
+	discarded := meta.Generations[len(meta.Generations)-steps:]
+	meta.Generations = meta.Generations[:len(meta.Generations)-steps]
+	for _, g := range discarded {
+		if err := os.RemoveAll(g.dir(i.installInto)); err != nil {
+			return fmt.Errorf("removing discarded generation %s: %w", g.Timestamp, err)
+		}
+	}
+	return meta.save(i.installInto)
+}
+
+// runCommands executes each command one by one, in order, stopping at the
+// first failure.
+func (i *Installer) runCommands(ctx context.Context, commands []string) error {
+	for _, cmd := range commands {
 		var stdout bytes.Buffer
 		var stderr bytes.Buffer
 		cmd := exec.CommandContext(ctx, i.shellCmd, "-c", cmd)
 		cmd.Stdout = &stdout
 		cmd.Stderr = &stderr
-		err := cmd.Run()
-		if err != nil {
-			return true, fmt.Errorf("executing '%s': %w (stdout %s, stderr %s)", cmd, err, stdout.String(), stderr.String())
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("executing '%s': %w (stdout %s, stderr %s)", cmd, err, stdout.String(), stderr.String())
 		}
 	}
-	return true, nil
+	return nil
 }
 
 // ErrNoUpdate is an error returned when there was no update in remote object storage
 // since the last call.
 var ErrNoUpdate = errors.New("no update since the last check")
 
-// checkLastModTime finds the newest updated object in all provided buckets.
-// If there was no update since the last check then it returns ErrNoUpdate.
-// If there was an update then it returns the bucket's index.
-func (i *Installer) checkLastModTime(ctx context.Context, installInto string) (int, error) {
+// checkLastModTime finds the newest updated object in all provided buckets
+// and returns its modification time alongside the bucket's index. If there
+// was no update since the last installed generation, it returns
+// ErrNoUpdate. The comparison is against the timestamp persisted in the
+// installed generation's metadata (see versions.go), not in-memory state, so
+// it survives a process restart.
+func (i *Installer) checkLastModTime(ctx context.Context) (time.Time, int, error) {
 	mTm, bi, err := i.extracter.findNewestFile(ctx)
 	if err != nil {
-		return bi, fmt.Errorf("finding newest file: %w", err)
+		return time.Time{}, bi, fmt.Errorf("finding newest file: %w", err)
+	}
+
+	meta, err := loadVersionsMeta(i.installInto)
+	if err != nil {
+		return mTm, bi, fmt.Errorf("loading versions metadata: %w", err)
 	}
 
-	// Check that modify time is ahead of the captured last mod time.
-	// NOTE: this does not do anything useful in single-shot mode, just exists as a safe programming check.
-	if mTm.Before(i.lastModTimeByObjectPath[i.bucketPath]) || mTm.Equal(i.lastModTimeByObjectPath[i.bucketPath]) {
-		_ = level.Debug(i.logger).Log("msg", "last modified time is ahead of the modified time in remote object storage", "modifyTime", mTm, "lastLocalModifyTime", i.lastModTimeByObjectPath[i.bucketPath])
-		return bi, ErrNoUpdate
+	latest, hasGeneration := meta.latest()
+	if !hasGeneration {
+		return mTm, bi, nil
 	}
 
-	// Ensure ctime is after modify time.
-	fi, err := os.Stat(installInto)
+	if mTm.Before(latest.SourceModTime) || mTm.Equal(latest.SourceModTime) {
+		i.logger.Debug("last modified time is ahead of the modified time in remote object storage", "modifyTime", mTm, "lastGenerationModifyTime", latest.SourceModTime)
+		return mTm, bi, ErrNoUpdate
+	}
+
+	// Ensure the installed generation's ctime is after modify time.
+	fi, err := os.Stat(latest.dir(i.installInto))
 	if err != nil {
-		return bi, fmt.Errorf("calling stat %s: %w", installInto, err)
+		return mTm, bi, fmt.Errorf("calling stat %s: %w", latest.dir(i.installInto), err)
 	}
 	stat, ok := fi.Sys().(*syscall.Stat_t)
 	if !ok {
-		return bi, fmt.Errorf("got wrong type (%T, expected syscall.Stat_t)", fi.Sys())
+		return mTm, bi, fmt.Errorf("got wrong type (%T, expected syscall.Stat_t)", fi.Sys())
 	}
 	ctime := time.Unix(int64(StatCtime(stat).Sec), int64(StatCtime(stat).Nsec))
 	if mTm.Before(ctime) {
-		_ = level.Debug(i.logger).Log("msg", "object is older in remote object storage", "modifyTime", mTm, "ctime", ctime)
-		return bi, ErrNoUpdate
+		i.logger.Debug("object is older in remote object storage", "modifyTime", mTm, "ctime", ctime)
+		return mTm, bi, ErrNoUpdate
 	}
 
-	i.lastModTimeByObjectPath[i.bucketPath] = mTm
-
-	return bi, nil
+	return mTm, bi, nil
 }
 
 type archiveExtracter struct {
-	bucketPath    string
-	bm            *downloader.BucketManager
-	logger        log.Logger
-	name          string
-	installInto   string
-	replacePrefix string
+	bucketPath   string
+	bm           *downloader.BucketManager
+	logger       *slog.Logger
+	name         string
+	patterns     *Patterns
+	verifiers    *bucketVerifiers
+	verification *artifactVerifier
 }
 
 func (e *archiveExtracter) findNewestFile(ctx context.Context) (lastUpdated time.Time, bucketIndex int, err error) {
 	return e.bm.FindNewestFile(ctx, e.bucketPath)
 }
 
-func (e *archiveExtracter) extractFiles(ctx context.Context, bucketIndex int) (bool, error) {
+func (e *archiveExtracter) extractFiles(ctx context.Context, bucketIndex int, targetDir string) (bool, error) {
+	logger := e.logger.With("bucket_index", bucketIndex, "key", e.bucketPath)
+	var m *manifest
+	if e.verifiers.enabled(bucketIndex) {
+		var err error
+		m, err = e.verifiers.fetch(ctx, e.bm, e.bucketPath, bucketIndex)
+		if err != nil {
+			return false, fmt.Errorf("verifying %s: %w", e.bucketPath, err)
+		}
+	}
+
 	rc, err := e.bm.GetFile(ctx, e.bucketPath, bucketIndex)
 	if err != nil {
 		return false, err
 	}
 	defer rc.Close()
 
+	var src io.Reader = rc
+	if e.verification != nil {
+		// Verification needs the whole artifact on disk before we can trust
+		// any of it, so download it into a temp file first instead of
+		// streaming straight into ExtractTarGz.
+		tmpFile, err := os.CreateTemp("", e.name)
+		if err != nil {
+			return false, fmt.Errorf("creating temp file for verification: %w", err)
+		}
+		defer func() {
+			tmpFile.Close()
+			_ = os.Remove(tmpFile.Name())
+		}()
+
+		if _, err := io.Copy(tmpFile, rc); err != nil {
+			return false, fmt.Errorf("downloading %s for verification: %w", e.bucketPath, err)
+		}
+
+		if err := e.verification.verify(ctx, e.bm, e.bucketPath, bucketIndex, tmpFile); err != nil {
+			return true, fmt.Errorf("verifying %s: %w", e.bucketPath, err)
+		}
+
+		if _, err := tmpFile.Seek(0, io.SeekStart); err != nil {
+			return true, fmt.Errorf("seeking verified artifact: %w", err)
+		}
+		src = tmpFile
+	}
+
 	// Extract into given path.
-	if err := ExtractTarGz(e.logger, e.name, e.installInto, e.replacePrefix, rc); err != nil {
+	if err := ExtractTarGz(logger, e.name, targetDir, e.patterns, m, src); err != nil {
 		return true, fmt.Errorf("extracting %s: %w", e.bucketPath, err)
 	}
 
@@ -312,19 +522,29 @@ func (e *archiveExtracter) extractFiles(ctx context.Context, bucketIndex int) (b
 }
 
 type directoryExtracter struct {
-	bucketPrefix  string
-	bm            *downloader.BucketManager
-	logger        log.Logger
-	name          string
-	installInto   string
-	replacePrefix string
+	bucketPrefix string
+	bm           *downloader.BucketManager
+	logger       *slog.Logger
+	name         string
+	patterns     *Patterns
+	verifiers    *bucketVerifiers
 }
 
 func (e *directoryExtracter) findNewestFile(ctx context.Context) (lastUpdated time.Time, bucketIndex int, err error) {
 	return e.bm.FindNewestInPrefix(ctx, e.bucketPrefix)
 }
 
-func (e *directoryExtracter) extractFiles(ctx context.Context, bucketIndex int) (bool, error) {
+func (e *directoryExtracter) extractFiles(ctx context.Context, bucketIndex int, targetDir string) (bool, error) {
+	logger := e.logger.With("bucket_index", bucketIndex)
+	var m *manifest
+	if e.verifiers.enabled(bucketIndex) {
+		var err error
+		m, err = e.verifiers.fetch(ctx, e.bm, e.bucketPrefix, bucketIndex)
+		if err != nil {
+			return false, fmt.Errorf("verifying %s: %w", e.bucketPrefix, err)
+		}
+	}
+
 	filesCh, err := e.bm.GetFiles(ctx, e.bucketPrefix, bucketIndex)
 	if err != nil {
 		return false, fmt.Errorf("starting to download files from the bucket: %w", err)
@@ -337,7 +557,7 @@ func (e *directoryExtracter) extractFiles(ctx context.Context, bucketIndex int)
 
 	defer func() {
 		if err := os.RemoveAll(tmpDir); err != nil {
-			_ = level.Debug(e.logger).Log("msg", "failed best effort clean up", "dir", tmpDir, "err", err)
+			logger.Debug("failed best effort clean up", "dir", tmpDir, "err", err)
 		}
 	}()
 
@@ -349,6 +569,9 @@ func (e *directoryExtracter) extractFiles(ctx context.Context, bucketIndex int)
 			if err != nil || f.Err != nil {
 				return err
 			}
+			if e.patterns.protected(f.Key) {
+				return nil
+			}
 
 			tmpFilePath := path.Join(tmpDir, f.Key)
 			tmpFile, err := os.Create(tmpFilePath)
@@ -357,7 +580,16 @@ func (e *directoryExtracter) extractFiles(ctx context.Context, bucketIndex int)
 			}
 			defer tmpFile.Close()
 
-			_, err = io.Copy(tmpFile, f.Content)
+			var src io.Reader = f.Content
+			if m != nil {
+				want, ok := m.digest(f.Key)
+				if !ok {
+					return fmt.Errorf("%w: %s: not listed in manifest", ErrIntegrityFailure, f.Key)
+				}
+				src = newHashingReader(f.Content, f.Key, want)
+			}
+
+			_, err = io.Copy(tmpFile, src)
 			if err != nil {
 				return fmt.Errorf("copying object content to temp file %s: %w", tmpFilePath, err)
 			}
@@ -369,18 +601,17 @@ func (e *directoryExtracter) extractFiles(ctx context.Context, bucketIndex int)
 		return false, fmt.Errorf("saving remote objects: %w", err)
 	}
 
-	// Copy over from tmpDir.
-	// If replacePrefix is specified, only remove files matching that prefix.
-	// Otherwise, remove all files (default behavior).
-	if err := removeContentsWithPrefix(e.installInto, e.replacePrefix); err != nil {
-		return true, fmt.Errorf("clearing %s: %w", e.installInto, err)
+	// Copy over from tmpDir, first clearing out whatever this grabber owns in
+	// targetDir so stale files from a previous install don't linger.
+	if err := removeOwnedContents(targetDir, e.patterns); err != nil {
+		return true, fmt.Errorf("clearing %s: %w", targetDir, err)
 	}
 
-	if err := cp.Copy(tmpDir, e.installInto, cp.Options{
+	if err := cp.Copy(tmpDir, targetDir, cp.Options{
 		PermissionControl: cp.DoNothing,
 		Sync:              true,
 	}); err != nil {
-		return true, fmt.Errorf("copying %s to %s: %w", tmpDir, e.installInto, err)
+		return true, fmt.Errorf("copying %s to %s: %w", tmpDir, targetDir, err)
 	}
 
 	return true, nil
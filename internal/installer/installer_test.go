@@ -5,24 +5,41 @@ import (
 	"bytes"
 	"compress/gzip"
 	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
 	"testing"
 
-	"github.com/go-kit/log"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/vinted/S3Grabber/internal/installer"
 )
 
-// createTestTarGz creates a tar.gz archive with the given files.
+// createTestTarGz creates a tar.gz archive with the given files, emitting a
+// directory entry for each intermediate path component first.
 // files is a map of filename -> content.
 func createTestTarGz(t *testing.T, files map[string]string) io.Reader {
 	var buf bytes.Buffer
 	gw := gzip.NewWriter(&buf)
 	tw := tar.NewWriter(gw)
 
+	dirSet := map[string]bool{}
+	for name := range files {
+		for dir := filepath.Dir(name); dir != "." && dir != "/"; dir = filepath.Dir(dir) {
+			dirSet[dir] = true
+		}
+	}
+	dirs := make([]string, 0, len(dirSet))
+	for dir := range dirSet {
+		dirs = append(dirs, dir)
+	}
+	sort.Slice(dirs, func(i, j int) bool { return len(dirs[i]) < len(dirs[j]) })
+	for _, dir := range dirs {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: dir, Mode: 0755, Typeflag: tar.TypeDir}))
+	}
+
 	for name, content := range files {
 		hdr := &tar.Header{
 			Name: name,
@@ -45,6 +62,7 @@ func setupTestDir(t *testing.T, files map[string]string) string {
 	tmpDir := t.TempDir()
 	for name, content := range files {
 		filePath := filepath.Join(tmpDir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(filePath), 0755))
 		require.NoError(t, os.WriteFile(filePath, []byte(content), 0644))
 	}
 	return tmpDir
@@ -82,8 +100,8 @@ func TestExtractTarGz_WithoutPrefix(t *testing.T) {
 	}
 	archive := createTestTarGz(t, archiveFiles)
 
-	// Extract without prefix (should remove all existing files)
-	err := installer.ExtractTarGz(log.NewNopLogger(), "test", tmpDir, "", archive)
+	// Extract without any Remove patterns (should remove all existing files)
+	err := installer.ExtractTarGz(slog.New(slog.NewTextHandler(io.Discard, nil)), "test", tmpDir, nil, nil, archive)
 	require.NoError(t, err)
 
 	// Verify: Only files from archive should exist
@@ -112,8 +130,10 @@ func TestExtractTarGz_WithPrefix(t *testing.T) {
 	}
 	archive := createTestTarGz(t, archiveFiles)
 
-	// Extract with "monitoring." prefix (should only remove monitoring.* files)
-	err := installer.ExtractTarGz(log.NewNopLogger(), "test", tmpDir, "monitoring.", archive)
+	// Extract with a "monitoring.*" Remove pattern (should only remove matching files)
+	patterns, err := installer.NewPatterns(nil, []string{"monitoring.*"})
+	require.NoError(t, err)
+	err = installer.ExtractTarGz(slog.New(slog.NewTextHandler(io.Discard, nil)), "test", tmpDir, patterns, nil, archive)
 	require.NoError(t, err)
 
 	// Verify: monitoring.* files replaced, others preserved
@@ -140,8 +160,10 @@ func TestExtractTarGz_WithPrefix_NoMatchingFiles(t *testing.T) {
 	}
 	archive := createTestTarGz(t, archiveFiles)
 
-	// Extract with "monitoring." prefix (no matching files to remove)
-	err := installer.ExtractTarGz(log.NewNopLogger(), "test", tmpDir, "monitoring.", archive)
+	// Extract with a "monitoring.*" Remove pattern (no matching files to remove)
+	patterns, err := installer.NewPatterns(nil, []string{"monitoring.*"})
+	require.NoError(t, err)
+	err = installer.ExtractTarGz(slog.New(slog.NewTextHandler(io.Discard, nil)), "test", tmpDir, patterns, nil, archive)
 	require.NoError(t, err)
 
 	// Verify: All existing files preserved + new file added
@@ -164,7 +186,7 @@ func TestExtractTarGz_EmptyDirectory(t *testing.T) {
 	archive := createTestTarGz(t, archiveFiles)
 
 	// Extract into empty directory
-	err := installer.ExtractTarGz(log.NewNopLogger(), "test", tmpDir, "", archive)
+	err := installer.ExtractTarGz(slog.New(slog.NewTextHandler(io.Discard, nil)), "test", tmpDir, nil, nil, archive)
 	require.NoError(t, err)
 
 	// Verify: Files extracted successfully
@@ -192,8 +214,10 @@ func TestExtractTarGz_WithPrefix_MultiplePatterns(t *testing.T) {
 		}
 		archive := createTestTarGz(t, archiveFiles)
 
-		// Extract with "vita." prefix
-		err := installer.ExtractTarGz(log.NewNopLogger(), "test", tmpDir, "vita.", archive)
+		// Extract with a "vita.*" Remove pattern
+		patterns, err := installer.NewPatterns(nil, []string{"vita.*"})
+		require.NoError(t, err)
+		err = installer.ExtractTarGz(slog.New(slog.NewTextHandler(io.Discard, nil)), "test", tmpDir, patterns, nil, archive)
 		require.NoError(t, err)
 
 		// Verify
@@ -221,8 +245,10 @@ func TestExtractTarGz_WithPrefix_MultiplePatterns(t *testing.T) {
 		}
 		archive := createTestTarGz(t, archiveFiles)
 
-		// Extract with "app." prefix
-		err := installer.ExtractTarGz(log.NewNopLogger(), "test", tmpDir, "app.", archive)
+		// Extract with an "app.*" Remove pattern
+		patterns, err := installer.NewPatterns(nil, []string{"app.*"})
+		require.NoError(t, err)
+		err = installer.ExtractTarGz(slog.New(slog.NewTextHandler(io.Discard, nil)), "test", tmpDir, patterns, nil, archive)
 		require.NoError(t, err)
 
 		// Verify
@@ -234,6 +260,37 @@ func TestExtractTarGz_WithPrefix_MultiplePatterns(t *testing.T) {
 	})
 }
 
+func TestExtractTarGz_KeepOverridesRemove(t *testing.T) {
+	// monitoring/ is owned by this grabber via a Remove glob, but
+	// monitoring/overrides/ is carved out with a Keep pattern so a second
+	// grabber can coexist underneath the same installInto.
+	existingFiles := map[string]string{
+		"monitoring/rules.yml":            "old rules",
+		"monitoring/overrides/custom.yml": "hand-written override",
+		"other.txt":                       "other file",
+	}
+	tmpDir := setupTestDir(t, existingFiles)
+
+	archiveFiles := map[string]string{
+		"monitoring/rules.yml": "new rules",
+	}
+	archive := createTestTarGz(t, archiveFiles)
+
+	patterns, err := installer.NewPatterns([]string{"monitoring/overrides/*"}, []string{"monitoring/**"})
+	require.NoError(t, err)
+	err = installer.ExtractTarGz(slog.New(slog.NewTextHandler(io.Discard, nil)), "test", tmpDir, patterns, nil, archive)
+	require.NoError(t, err)
+
+	resultFiles := getFilesInDir(t, filepath.Join(tmpDir, "monitoring"))
+	assert.Equal(t, "new rules", resultFiles["rules.yml"])
+
+	overrideFiles := getFilesInDir(t, filepath.Join(tmpDir, "monitoring", "overrides"))
+	assert.Equal(t, "hand-written override", overrideFiles["custom.yml"], "Keep pattern should protect the override")
+
+	topLevelFiles := getFilesInDir(t, tmpDir)
+	assert.Equal(t, "other file", topLevelFiles["other.txt"])
+}
+
 func TestIsEmptyDir(t *testing.T) {
 	t.Run("empty directory", func(t *testing.T) {
 		tmpDir := t.TempDir()
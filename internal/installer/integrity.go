@@ -0,0 +1,188 @@
+package installer
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/vinted/S3Grabber/internal/cfg"
+	"github.com/vinted/S3Grabber/internal/downloader"
+)
+
+// ErrIntegrityFailure is returned when downloaded content does not match a
+// bucket's signed manifest (see BucketConfig.ManifestSuffix), either because
+// a file's digest mismatched or because the manifest's own signature failed
+// to verify against the configured public key.
+var ErrIntegrityFailure = errors.New("content integrity verification failed")
+
+// manifestEntry is one file's expected digest inside a manifest.
+type manifestEntry struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// manifest is the restic-style per-file digest list that must sit alongside
+// a grabbed object or directory prefix in the bucket, signed with an ed25519
+// key whose public half is pinned in BucketConfig.PublicKey.
+type manifest struct {
+	Files     []manifestEntry `json:"files"`
+	Signature string          `json:"signature"`
+
+	digestByPath map[string]string
+}
+
+func parseManifest(raw []byte) (*manifest, error) {
+	var m manifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("parsing manifest JSON: %w", err)
+	}
+	m.digestByPath = make(map[string]string, len(m.Files))
+	for _, f := range m.Files {
+		m.digestByPath[f.Path] = f.SHA256
+	}
+	return &m, nil
+}
+
+// signedPayload is the canonical byte sequence the manifest's signature
+// covers: one "sha256  path" line per file, sorted for determinism.
+func (m *manifest) signedPayload() []byte {
+	lines := make([]string, 0, len(m.Files))
+	for _, f := range m.Files {
+		lines = append(lines, fmt.Sprintf("%s  %s", f.SHA256, f.Path))
+	}
+	sort.Strings(lines)
+	return []byte(strings.Join(lines, "\n"))
+}
+
+func (m *manifest) verifySignature(pub ed25519.PublicKey) error {
+	sig, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: decoding manifest signature: %s", ErrIntegrityFailure, err)
+	}
+	if !ed25519.Verify(pub, m.signedPayload(), sig) {
+		return fmt.Errorf("%w: manifest signature does not verify", ErrIntegrityFailure)
+	}
+	return nil
+}
+
+// digest returns the expected SHA-256 digest (hex) for path, or false if the
+// manifest doesn't list it.
+func (m *manifest) digest(path string) (string, bool) {
+	d, ok := m.digestByPath[path]
+	return d, ok
+}
+
+func parseEd25519PublicKey(pemStr string) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode([]byte(pemStr))
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in public key")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing public key: %w", err)
+	}
+	edPub, ok := pub.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key is not ed25519")
+	}
+	return edPub, nil
+}
+
+// hashingReader wraps a reader, computing a running SHA-256 digest as it is
+// read, and fails the final Read with ErrIntegrityFailure if the digest
+// doesn't match want once the underlying reader is exhausted.
+type hashingReader struct {
+	r    io.Reader
+	h    hash.Hash
+	path string
+	want string
+}
+
+func newHashingReader(r io.Reader, path, want string) *hashingReader {
+	return &hashingReader{r: r, h: sha256.New(), path: path, want: want}
+}
+
+func (h *hashingReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	if n > 0 {
+		h.h.Write(p[:n])
+	}
+	if err == io.EOF {
+		if got := hex.EncodeToString(h.h.Sum(nil)); got != h.want {
+			return n, fmt.Errorf("%w: %s: expected sha256 %s, got %s", ErrIntegrityFailure, h.path, h.want, got)
+		}
+	}
+	return n, err
+}
+
+// bucketVerifiers resolves, per configured bucket index, the manifest
+// suffix and public key (if any) used to verify content downloaded from it.
+// A nil *bucketVerifiers, or an index with no public key configured, means
+// verification is skipped for that bucket.
+type bucketVerifiers struct {
+	manifestSuffix []string
+	publicKey      []ed25519.PublicKey
+}
+
+// newBucketVerifiers resolves one bucketVerifiers per grabber from the
+// buckets it reads from, in the same order they were passed to
+// downloader.NewBucketManager, so indices line up with findNewestFile's
+// bucketIndex.
+func newBucketVerifiers(buckets []cfg.BucketConfig) (*bucketVerifiers, error) {
+	v := &bucketVerifiers{
+		manifestSuffix: make([]string, len(buckets)),
+		publicKey:      make([]ed25519.PublicKey, len(buckets)),
+	}
+	for i, b := range buckets {
+		v.manifestSuffix[i] = b.ManifestSuffix
+		if b.PublicKey == "" {
+			continue
+		}
+		pub, err := parseEd25519PublicKey(b.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("bucket %d: parsing public key: %w", i, err)
+		}
+		v.publicKey[i] = pub
+	}
+	return v, nil
+}
+
+// enabled reports whether verification is configured for bucketIndex.
+func (v *bucketVerifiers) enabled(bucketIndex int) bool {
+	return v != nil && bucketIndex < len(v.publicKey) && v.publicKey[bucketIndex] != nil && v.manifestSuffix[bucketIndex] != ""
+}
+
+// fetch downloads the manifest for objectPath from bucketIndex (objectPath
+// with the configured ManifestSuffix appended) and verifies its signature.
+func (v *bucketVerifiers) fetch(ctx context.Context, bm *downloader.BucketManager, objectPath string, bucketIndex int) (*manifest, error) {
+	rc, err := bm.GetFile(ctx, objectPath+v.manifestSuffix[bucketIndex], bucketIndex)
+	if err != nil {
+		return nil, fmt.Errorf("fetching manifest: %w", err)
+	}
+	defer rc.Close()
+
+	raw, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+
+	m, err := parseManifest(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.verifySignature(v.publicKey[bucketIndex]); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,96 @@
+package installer
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signedManifest builds and signs a manifest for the given file contents,
+// keyed by archive path.
+func signedManifest(t *testing.T, priv ed25519.PrivateKey, files map[string]string) *manifest {
+	t.Helper()
+	m := &manifest{}
+	for name, content := range files {
+		sum := sha256.Sum256([]byte(content))
+		m.Files = append(m.Files, manifestEntry{Path: name, SHA256: hex.EncodeToString(sum[:])})
+	}
+	sig := ed25519.Sign(priv, m.signedPayload())
+	m.Signature = base64.StdEncoding.EncodeToString(sig)
+
+	m.digestByPath = make(map[string]string, len(m.Files))
+	for _, f := range m.Files {
+		m.digestByPath[f.Path] = f.SHA256
+	}
+	return m
+}
+
+func archiveOf(t *testing.T, files map[string]string) io.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestExtractTarGz_ManifestVerification_Success(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	files := map[string]string{"app.yml": "app config"}
+	m := signedManifest(t, priv, files)
+
+	tmpDir := t.TempDir()
+	require.NoError(t, ExtractTarGz(slog.New(slog.NewTextHandler(io.Discard, nil)), "test", tmpDir, nil, m, archiveOf(t, files)))
+
+	content, err := os.ReadFile(tmpDir + "/app.yml")
+	require.NoError(t, err)
+	assert.Equal(t, "app config", string(content))
+}
+
+func TestExtractTarGz_ManifestVerification_DigestMismatch(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	m := signedManifest(t, priv, map[string]string{"app.yml": "app config"})
+
+	tmpDir := t.TempDir()
+	// The archive entry's actual content no longer matches what was signed.
+	err = ExtractTarGz(slog.New(slog.NewTextHandler(io.Discard, nil)), "test", tmpDir, nil, m, archiveOf(t, map[string]string{"app.yml": "tampered config"}))
+	require.ErrorIs(t, err, ErrIntegrityFailure)
+
+	_, statErr := os.ReadFile(tmpDir + "/app.yml")
+	assert.True(t, os.IsNotExist(statErr), "tampered content must never reach the target directory")
+}
+
+func TestExtractTarGz_ManifestVerification_FileNotListed(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	m := signedManifest(t, priv, map[string]string{"app.yml": "app config"})
+
+	tmpDir := t.TempDir()
+	err = ExtractTarGz(slog.New(slog.NewTextHandler(io.Discard, nil)), "test", tmpDir, nil, m, archiveOf(t, map[string]string{
+		"app.yml":      "app config",
+		"injected.yml": "not in the manifest",
+	}))
+	require.ErrorIs(t, err, ErrIntegrityFailure)
+}
@@ -0,0 +1,23 @@
+package installer
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Metrics holds the Prometheus collectors for installer-level events that
+// aren't tied to a specific bucket download. Construct one instance per
+// process and pass it to every NewArchiveInstaller/NewDirectoryInstaller
+// call.
+type Metrics struct {
+	verificationFailuresTotal prometheus.Counter
+}
+
+func NewMetrics(registerer prometheus.Registerer) *Metrics {
+	return &Metrics{
+		verificationFailuresTotal: promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+			Name: "verification_failures_total",
+			Help: "How many times artifact verification failed",
+		}),
+	}
+}
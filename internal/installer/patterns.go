@@ -0,0 +1,139 @@
+package installer
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/moby/patternmatcher"
+)
+
+// Patterns decides, for a path relative to an install directory (or to the
+// root of an archive being extracted), whether that path is owned by a
+// grabber's Remove patterns and therefore safe to clear before a fresh
+// install, and separately whether it is protected by a Keep pattern and
+// therefore must never be touched, even by a freshly extracted archive.
+//
+// Remove patterns are dockerignore-style globs; Keep patterns are appended
+// as negations ("!pattern") after them when deciding ownership, so they are
+// evaluated last and always win, same as Docker's .dockerignore precedence.
+// This lets one grabber own a subtree of installInto via Remove while a Keep
+// carves out an exception for files another grabber manages.
+type Patterns struct {
+	ownerMatcher *patternmatcher.PatternMatcher
+	keepMatcher  *patternmatcher.PatternMatcher
+}
+
+// NewPatterns compiles keep/remove glob lists into a matcher. It returns a
+// nil *Patterns when both lists are empty, which callers treat as "own
+// everything under installInto" (replace the whole directory on each
+// install, same as before Keep/Remove patterns existed).
+func NewPatterns(keep, remove []string) (*Patterns, error) {
+	if len(keep) == 0 && len(remove) == 0 {
+		return nil, nil
+	}
+
+	ownerPatterns := make([]string, 0, len(remove)+len(keep))
+	ownerPatterns = append(ownerPatterns, remove...)
+	for _, k := range keep {
+		ownerPatterns = append(ownerPatterns, "!"+k)
+	}
+	ownerMatcher, err := patternmatcher.New(ownerPatterns)
+	if err != nil {
+		return nil, fmt.Errorf("compiling keep/remove patterns: %w", err)
+	}
+
+	keepMatcher, err := patternmatcher.New(keep)
+	if err != nil {
+		return nil, fmt.Errorf("compiling keep patterns: %w", err)
+	}
+
+	return &Patterns{ownerMatcher: ownerMatcher, keepMatcher: keepMatcher}, nil
+}
+
+// owns reports whether rel, a slash-separated path relative to the install
+// directory or archive root, is claimed by the Remove patterns (and not
+// carved back out by a Keep pattern). A nil receiver owns everything.
+func (p *Patterns) owns(rel string) bool {
+	if p == nil {
+		return true
+	}
+	matched, err := p.ownerMatcher.MatchesOrParentMatches(filepath.ToSlash(rel))
+	return err == nil && matched
+}
+
+// protected reports whether rel is carved out by a Keep pattern and must
+// therefore be left untouched, even by a freshly extracted archive that
+// happens to bundle a file under that path. A nil receiver protects nothing.
+func (p *Patterns) protected(rel string) bool {
+	if p == nil {
+		return false
+	}
+	matched, err := p.keepMatcher.MatchesOrParentMatches(filepath.ToSlash(rel))
+	return err == nil && matched
+}
+
+// removeOwnedContents removes every regular file under dir that patterns
+// owns, then prunes directories left empty by the removal. A nil patterns
+// owns everything, so this removes the whole contents of dir.
+func removeOwnedContents(dir string, patterns *Patterns) error {
+	var toRemove []string
+	if err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == dir || d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return fmt.Errorf("computing relative path for %s: %w", p, err)
+		}
+		if patterns.owns(rel) {
+			toRemove = append(toRemove, p)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("walking %s: %w", dir, err)
+	}
+
+	for _, p := range toRemove {
+		if err := os.Remove(p); err != nil {
+			return fmt.Errorf("removing %s: %w", p, err)
+		}
+	}
+
+	return pruneEmptyDirs(dir)
+}
+
+// pruneEmptyDirs removes directories under (but not including) root that
+// removeOwnedContents left empty.
+func pruneEmptyDirs(root string) error {
+	var dirs []string
+	if err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != root && d.IsDir() {
+			dirs = append(dirs, p)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("walking %s: %w", root, err)
+	}
+
+	// Remove deepest directories first so parents can become empty in turn.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		empty, err := IsEmptyDir(dirs[i])
+		if err != nil {
+			return fmt.Errorf("checking %s: %w", dirs[i], err)
+		}
+		if empty {
+			if err := os.Remove(dirs[i]); err != nil {
+				return fmt.Errorf("removing empty dir %s: %w", dirs[i], err)
+			}
+		}
+	}
+	return nil
+}
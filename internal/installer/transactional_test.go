@@ -0,0 +1,170 @@
+package installer
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vinted/S3Grabber/internal/cfg"
+)
+
+// fakeExtracter is a white-box stand-in for archiveExtracter/directoryExtracter
+// that lets tests drive Install's staging/swap/rollback behaviour without a
+// real bucket.
+type fakeExtracter struct {
+	modTime     time.Time
+	bucketIndex int
+	findErr     error
+	extractErr  error
+	// writeFile, if set, is written into targetDir on each extractFiles call,
+	// simulating a newly extracted file.
+	writeFile string
+	content   string
+}
+
+func (f *fakeExtracter) findNewestFile(ctx context.Context) (time.Time, int, error) {
+	return f.modTime, f.bucketIndex, f.findErr
+}
+
+func (f *fakeExtracter) extractFiles(ctx context.Context, bucketIndex int, targetDir string) (bool, error) {
+	if f.extractErr != nil {
+		return false, f.extractErr
+	}
+	if f.writeFile != "" {
+		if err := os.WriteFile(filepath.Join(targetDir, f.writeFile), []byte(f.content), 0644); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func newTestInstaller(t *testing.T, installInto string, commands, rollbackCommands []string, retention cfg.RetentionConfig, extracter extracter) *Installer {
+	t.Helper()
+	return newInstaller("test", nil, commands, rollbackCommands, "/some/path", installInto, "/bin/sh", 5*time.Second, retention, slog.New(slog.NewTextHandler(io.Discard, nil)), extracter)
+}
+
+// currentGenerationFile reads a file out of whatever generation installInto
+// currently points at.
+func currentGenerationFile(t *testing.T, installInto, name string) string {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join(installInto, name))
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestInstall_TransactionalSwap(t *testing.T) {
+	parent := t.TempDir()
+	installInto := filepath.Join(parent, "current")
+	require.NoError(t, os.MkdirAll(installInto, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(installInto, "existing.txt"), []byte("old"), 0644))
+
+	inst := newTestInstaller(t, installInto, nil, nil, cfg.RetentionConfig{}, &fakeExtracter{
+		modTime:   time.Now(),
+		writeFile: "new.txt",
+		content:   "new content",
+	})
+
+	attempted, err := inst.installTransactionally(context.Background(), 0, time.Now())
+	require.NoError(t, err)
+	assert.True(t, attempted)
+
+	assert.Equal(t, "new content", currentGenerationFile(t, installInto, "new.txt"))
+
+	// installInto must now be a symlink into .versions, and the previous
+	// generation's content (from before the first versioned install) must
+	// have been carried over.
+	fi, err := os.Lstat(installInto)
+	require.NoError(t, err)
+	assert.True(t, fi.Mode()&os.ModeSymlink != 0, "installInto should be a symlink")
+	assert.Equal(t, "old", currentGenerationFile(t, installInto, "existing.txt"))
+
+	generations, err := ListGenerations(installInto)
+	require.NoError(t, err)
+	assert.Len(t, generations, 1)
+}
+
+func TestInstall_RollbackOnCommandFailure(t *testing.T) {
+	parent := t.TempDir()
+	installInto := filepath.Join(parent, "current")
+	require.NoError(t, os.MkdirAll(installInto, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(installInto, "existing.txt"), []byte("old"), 0644))
+
+	// Install once successfully so there is a previous generation to roll
+	// back to.
+	first := newTestInstaller(t, installInto, nil, nil, cfg.RetentionConfig{}, &fakeExtracter{modTime: time.Now()})
+	_, err := first.installTransactionally(context.Background(), 0, time.Now())
+	require.NoError(t, err)
+
+	rollbackMarker := filepath.Join(t.TempDir(), "rollback-ran")
+	second := newTestInstaller(t,
+		installInto,
+		[]string{"exit 1"},
+		[]string{"touch " + rollbackMarker},
+		cfg.RetentionConfig{},
+		&fakeExtracter{modTime: time.Now(), writeFile: "new.txt", content: "new content"},
+	)
+
+	attempted, err := second.installTransactionally(context.Background(), 0, time.Now())
+	require.Error(t, err)
+	assert.True(t, attempted)
+
+	// installInto must be restored to the previous generation.
+	assert.Equal(t, "old", currentGenerationFile(t, installInto, "existing.txt"))
+	assert.NoFileExists(t, filepath.Join(installInto, "new.txt"))
+
+	// RollbackCommands must have run.
+	assert.FileExists(t, rollbackMarker)
+}
+
+func TestInstall_RetentionPrunesOldGenerations(t *testing.T) {
+	parent := t.TempDir()
+	installInto := filepath.Join(parent, "current")
+
+	retention := cfg.RetentionConfig{KeepLast: 1}
+	for i := 0; i < 3; i++ {
+		inst := newTestInstaller(t, installInto, nil, nil, retention, &fakeExtracter{
+			modTime:   time.Now(),
+			writeFile: "gen.txt",
+			content:   string(rune('a' + i)),
+		})
+		_, err := inst.installTransactionally(context.Background(), 0, time.Now())
+		require.NoError(t, err)
+	}
+
+	generations, err := ListGenerations(installInto)
+	require.NoError(t, err)
+	assert.Len(t, generations, 1, "only the most recent generation should survive KeepLast: 1")
+
+	assert.Equal(t, "c", currentGenerationFile(t, installInto, "gen.txt"))
+}
+
+func TestInstaller_Rollback(t *testing.T) {
+	parent := t.TempDir()
+	installInto := filepath.Join(parent, "current")
+
+	for _, content := range []string{"v1", "v2"} {
+		inst := newTestInstaller(t, installInto, nil, nil, cfg.RetentionConfig{}, &fakeExtracter{
+			modTime:   time.Now(),
+			writeFile: "gen.txt",
+			content:   content,
+		})
+		_, err := inst.installTransactionally(context.Background(), 0, time.Now())
+		require.NoError(t, err)
+	}
+	assert.Equal(t, "v2", currentGenerationFile(t, installInto, "gen.txt"))
+
+	inst := newTestInstaller(t, installInto, nil, nil, cfg.RetentionConfig{}, &fakeExtracter{})
+	require.NoError(t, inst.Rollback(context.Background(), 1))
+
+	assert.Equal(t, "v1", currentGenerationFile(t, installInto, "gen.txt"))
+
+	generations, err := ListGenerations(installInto)
+	require.NoError(t, err)
+	assert.Len(t, generations, 1, "generations newer than the rollback target should be discarded")
+}
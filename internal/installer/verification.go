@@ -0,0 +1,411 @@
+package installer
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/vinted/S3Grabber/internal/cfg"
+	"github.com/vinted/S3Grabber/internal/downloader"
+)
+
+// ErrVerificationFailure is returned when a downloaded artifact fails one of
+// the checks configured in GrabberConfig.Verification: a checksum mismatch,
+// an invalid signature, or a keyless certificate/log entry that doesn't
+// match what was configured.
+var ErrVerificationFailure = errors.New("artifact verification failed")
+
+// artifactVerifier runs the checks configured in cfg.VerificationConfig
+// against a single downloaded artifact.
+type artifactVerifier struct {
+	cfg     cfg.VerificationConfig
+	metrics *Metrics
+}
+
+// newArtifactVerifier returns nil if vc is nil, same convention as
+// bucketVerifiers -- a nil *artifactVerifier means verification is skipped.
+func newArtifactVerifier(vc *cfg.VerificationConfig, metrics *Metrics) *artifactVerifier {
+	if vc == nil {
+		return nil
+	}
+	return &artifactVerifier{cfg: *vc, metrics: metrics}
+}
+
+// verify runs every configured check against content, which must support
+// seeking back to the start between checks. path and bucketIndex identify
+// where content came from, used to fetch its sidecar objects from the same
+// bucket.
+func (v *artifactVerifier) verify(ctx context.Context, bm *downloader.BucketManager, path string, bucketIndex int, content *os.File) (rerr error) {
+	defer func() {
+		if rerr != nil && v.metrics != nil {
+			v.metrics.verificationFailuresTotal.Inc()
+		}
+	}()
+
+	if v.cfg.Checksum != nil {
+		if err := v.verifyChecksum(ctx, bm, path, bucketIndex, content); err != nil {
+			return err
+		}
+	}
+	if v.cfg.Signature != nil {
+		if err := v.verifySignature(ctx, bm, path, bucketIndex, content); err != nil {
+			return err
+		}
+	}
+	if v.cfg.Keyless != nil {
+		if err := v.verifyKeyless(ctx, bm, path, bucketIndex, content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fetchSidecar(ctx context.Context, bm *downloader.BucketManager, path string, bucketIndex int) ([]byte, error) {
+	rc, err := bm.GetFile(ctx, path, bucketIndex)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func (v *artifactVerifier) verifyChecksum(ctx context.Context, bm *downloader.BucketManager, path string, bucketIndex int, content *os.File) error {
+	c := v.cfg.Checksum
+
+	algo := strings.ToLower(c.Algorithm)
+	if algo == "" {
+		algo = "sha256"
+	}
+	var h hash.Hash
+	switch algo {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return fmt.Errorf("%w: unsupported checksum algorithm %q", ErrVerificationFailure, c.Algorithm)
+	}
+
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seeking artifact: %w", err)
+	}
+	if _, err := io.Copy(h, content); err != nil {
+		return fmt.Errorf("hashing artifact: %w", err)
+	}
+	got := hex.EncodeToString(h.Sum(nil))
+
+	raw, err := fetchSidecar(ctx, bm, path+c.Suffix, bucketIndex)
+	if err != nil {
+		return fmt.Errorf("fetching checksum sidecar: %w", err)
+	}
+	// Sidecar files are either a bare hex digest or the "<digest>  <filename>"
+	// format sha256sum/sha512sum produce -- only the first field matters.
+	fields := strings.Fields(string(raw))
+	if len(fields) == 0 {
+		return fmt.Errorf("%w: checksum sidecar for %s is empty", ErrVerificationFailure, path)
+	}
+	want := fields[0]
+
+	if !strings.EqualFold(got, want) {
+		return fmt.Errorf("%w: %s: expected %s %s, got %s", ErrVerificationFailure, path, algo, want, got)
+	}
+	return nil
+}
+
+// verifySignature checks a detached signature sidecar against content. The
+// sidecar may be a minisign signature file or a bare base64-encoded ed25519
+// signature; it is checked against every configured public key until one
+// verifies.
+func (v *artifactVerifier) verifySignature(ctx context.Context, bm *downloader.BucketManager, path string, bucketIndex int, content *os.File) error {
+	s := v.cfg.Signature
+
+	raw, err := fetchSidecar(ctx, bm, path+s.Suffix, bucketIndex)
+	if err != nil {
+		return fmt.Errorf("fetching signature sidecar: %w", err)
+	}
+	sig, err := parseSignature(raw)
+	if err != nil {
+		return fmt.Errorf("%w: parsing signature: %s", ErrVerificationFailure, err)
+	}
+
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seeking artifact: %w", err)
+	}
+	body, err := io.ReadAll(content)
+	if err != nil {
+		return fmt.Errorf("reading artifact: %w", err)
+	}
+
+	for _, keyStr := range s.PublicKeys {
+		pub, err := parseSignaturePublicKey(keyStr)
+		if err != nil {
+			continue
+		}
+		if ed25519.Verify(pub, body, sig) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s: signature does not verify against any configured public key", ErrVerificationFailure, path)
+}
+
+// parseSignature extracts the raw 64-byte ed25519 signature from either a
+// minisign signature file (an "untrusted comment:" line followed by a
+// base64-encoded sig_alg+key_id+signature blob) or a bare base64-encoded
+// signature. Only minisign's legacy (non-prehashed, "Ed") algorithm is
+// supported; the optional trusted-comment global signature is not checked.
+func parseSignature(raw []byte) ([]byte, error) {
+	lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+
+	b64 := lines[0]
+	if strings.HasPrefix(lines[0], "untrusted comment:") && len(lines) > 1 {
+		b64 = lines[1]
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(b64))
+	if err != nil {
+		return nil, fmt.Errorf("decoding base64: %w", err)
+	}
+
+	switch len(decoded) {
+	case ed25519.SignatureSize:
+		return decoded, nil
+	case 2 + 8 + ed25519.SignatureSize: // minisign: sig_alg(2) + key_id(8) + signature
+		if string(decoded[:2]) != "Ed" {
+			return nil, fmt.Errorf("unsupported minisign algorithm %q, only legacy Ed25519 is supported", decoded[:2])
+		}
+		return decoded[10:], nil
+	default:
+		return nil, fmt.Errorf("unexpected signature length %d", len(decoded))
+	}
+}
+
+// parseSignaturePublicKey accepts a minisign public key ("untrusted comment:"
+// line + base64-encoded sig_alg+key_id+key), a PEM-encoded ed25519 public key
+// (same format as BucketConfig.PublicKey), or a bare base64-encoded key.
+func parseSignaturePublicKey(keyStr string) (ed25519.PublicKey, error) {
+	trimmed := strings.TrimSpace(keyStr)
+	if strings.HasPrefix(trimmed, "-----BEGIN") {
+		return parseEd25519PublicKey(trimmed)
+	}
+
+	lines := strings.Split(trimmed, "\n")
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[len(lines)-1]))
+	if err != nil {
+		return nil, fmt.Errorf("decoding base64: %w", err)
+	}
+
+	switch len(decoded) {
+	case ed25519.PublicKeySize:
+		return ed25519.PublicKey(decoded), nil
+	case 2 + 8 + ed25519.PublicKeySize: // minisign: sig_alg(2) + key_id(8) + public key
+		return ed25519.PublicKey(decoded[10:]), nil
+	default:
+		return nil, fmt.Errorf("unexpected public key length %d", len(decoded))
+	}
+}
+
+// keylessBundle is the subset of a cosign-style signing bundle sidecar we
+// verify without a full Sigstore client: a short-lived certificate issued by
+// a Fulcio-compatible CA to a signer identity, the signature it made over
+// the artifact, and the index of the corresponding transparency log entry.
+type keylessBundle struct {
+	Certificate string `json:"certificate"` // PEM
+	Signature   string `json:"signature"`   // base64, over the raw artifact bytes
+	LogIndex    int64  `json:"logIndex"`
+}
+
+// fulcioIssuerOID is the X.509 extension Fulcio embeds the signer's OIDC
+// issuer in.
+var fulcioIssuerOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+
+// verifyKeyless checks a cosign-style keyless signature bundle sidecar: the
+// certificate must chain to FulcioURL's root, its issuer extension/SAN must
+// match Issuer/Identity, and the signature must verify against the
+// certificate's key.
+//
+// It also confirms that LogIndex exists at RekorURL and recorded this exact
+// signature, but does not verify Rekor's Merkle inclusion proof -- so,
+// unlike the certificate and signature checks above, this step trusts the
+// Rekor operator not to have fabricated the entry. Because Fulcio certs are
+// only valid for a few minutes around when they were issued, the Rekor
+// lookup is done first so its integrated timestamp -- not wall-clock
+// time.Now(), which by the time S3Grabber gets around to verifying an
+// artifact may be long past the cert's window -- can anchor the chain
+// check.
+func (v *artifactVerifier) verifyKeyless(ctx context.Context, bm *downloader.BucketManager, path string, bucketIndex int, content *os.File) error {
+	k := v.cfg.Keyless
+
+	raw, err := fetchSidecar(ctx, bm, path+k.Suffix, bucketIndex)
+	if err != nil {
+		return fmt.Errorf("fetching keyless bundle sidecar: %w", err)
+	}
+	var bundle keylessBundle
+	if err := json.Unmarshal(raw, &bundle); err != nil {
+		return fmt.Errorf("%w: parsing keyless bundle: %s", ErrVerificationFailure, err)
+	}
+
+	block, _ := pem.Decode([]byte(bundle.Certificate))
+	if block == nil {
+		return fmt.Errorf("%w: no PEM block in keyless certificate", ErrVerificationFailure)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("%w: parsing keyless certificate: %s", ErrVerificationFailure, err)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(bundle.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: decoding keyless signature: %s", ErrVerificationFailure, err)
+	}
+
+	loggedAt, err := verifyRekorEntry(ctx, k.RekorURL, bundle.LogIndex, sig)
+	if err != nil {
+		return err
+	}
+
+	if err := verifyFulcioChain(ctx, k.FulcioURL, cert, loggedAt); err != nil {
+		return err
+	}
+	if err := verifyCertificateIdentity(cert, k.Issuer, k.Identity); err != nil {
+		return err
+	}
+
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seeking artifact: %w", err)
+	}
+	body, err := io.ReadAll(content)
+	if err != nil {
+		return fmt.Errorf("reading artifact: %w", err)
+	}
+
+	switch pub := cert.PublicKey.(type) {
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, body, sig) {
+			return fmt.Errorf("%w: keyless signature does not verify", ErrVerificationFailure)
+		}
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(body)
+		if !ecdsa.VerifyASN1(pub, digest[:], sig) {
+			return fmt.Errorf("%w: keyless signature does not verify", ErrVerificationFailure)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported certificate key type %T", ErrVerificationFailure, cert.PublicKey)
+	}
+
+	return nil
+}
+
+// verifyFulcioChain checks that cert chains to fulcioURL's root, with
+// validity checked as of currentTime rather than wall-clock time.Now() --
+// Fulcio certs are short-lived (~10 minutes), so by the time S3Grabber gets
+// around to verifying an artifact, now() has almost always moved past the
+// cert's window.
+func verifyFulcioChain(ctx context.Context, fulcioURL string, cert *x509.Certificate, currentTime time.Time) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(fulcioURL, "/")+"/api/v1/rootCert", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetching Fulcio root: %w", err)
+	}
+	defer resp.Body.Close()
+	rootPEM, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading Fulcio root: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(rootPEM) {
+		return fmt.Errorf("%w: invalid Fulcio root certificate", ErrVerificationFailure)
+	}
+
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}, CurrentTime: currentTime}); err != nil {
+		return fmt.Errorf("%w: certificate does not chain to Fulcio root: %s", ErrVerificationFailure, err)
+	}
+	return nil
+}
+
+func verifyCertificateIdentity(cert *x509.Certificate, wantIssuer, wantIdentity string) error {
+	var gotIssuer string
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(fulcioIssuerOID) {
+			if _, err := asn1.Unmarshal(ext.Value, &gotIssuer); err != nil {
+				return fmt.Errorf("%w: decoding certificate issuer extension: %s", ErrVerificationFailure, err)
+			}
+		}
+	}
+	if wantIssuer != "" && gotIssuer != wantIssuer {
+		return fmt.Errorf("%w: certificate issuer %q does not match configured issuer %q", ErrVerificationFailure, gotIssuer, wantIssuer)
+	}
+
+	if wantIdentity == "" {
+		return nil
+	}
+	for _, uri := range cert.URIs {
+		if uri.String() == wantIdentity {
+			return nil
+		}
+	}
+	for _, email := range cert.EmailAddresses {
+		if email == wantIdentity {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: certificate identity does not match configured identity %q", ErrVerificationFailure, wantIdentity)
+}
+
+// verifyRekorEntry confirms that logIndex exists in the transparency log at
+// rekorURL and was recorded for sig, returning the time Rekor logged it at.
+func verifyRekorEntry(ctx context.Context, rekorURL string, logIndex int64, sig []byte) (time.Time, error) {
+	url := fmt.Sprintf("%s/api/v1/log/entries?logIndex=%d", strings.TrimSuffix(rekorURL, "/"), logIndex)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("fetching Rekor entry: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return time.Time{}, fmt.Errorf("%w: Rekor entry %d not found: status %s", ErrVerificationFailure, logIndex, resp.Status)
+	}
+
+	var entries map[string]struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return time.Time{}, fmt.Errorf("decoding Rekor entry: %w", err)
+	}
+
+	sigB64 := base64.StdEncoding.EncodeToString(sig)
+	for _, e := range entries {
+		decodedBody, err := base64.StdEncoding.DecodeString(e.Body)
+		if err != nil {
+			continue
+		}
+		if bytes.Contains(decodedBody, []byte(sigB64)) {
+			return time.Unix(e.IntegratedTime, 0), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: no Rekor entry at index %d matches this signature", ErrVerificationFailure, logIndex)
+}
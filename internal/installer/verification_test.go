@@ -0,0 +1,395 @@
+package installer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vinted/S3Grabber/internal/cfg"
+	"github.com/vinted/S3Grabber/internal/downloader"
+	"gopkg.in/yaml.v3"
+)
+
+func filesystemBucketManager(t *testing.T, root string) *downloader.BucketManager {
+	t.Helper()
+	var node yaml.Node
+	require.NoError(t, node.Encode(map[string]string{"path": root}))
+
+	bm, err := downloader.NewBucketManager(context.Background(), []cfg.BucketConfig{
+		{Type: "filesystem", Config: node},
+	}, cfg.DownloadLimits{}, nil, nil)
+	require.NoError(t, err)
+	return bm
+}
+
+func writeArtifact(t *testing.T, root string) *os.File {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "app.tar.gz"), []byte("artifact contents"), 0644))
+	f, err := os.Open(filepath.Join(root, "app.tar.gz"))
+	require.NoError(t, err)
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestArtifactVerifier_Checksum(t *testing.T) {
+	root := t.TempDir()
+	bm := filesystemBucketManager(t, root)
+	f := writeArtifact(t, root)
+
+	sum := sha256.Sum256([]byte("artifact contents"))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "app.tar.gz.sha256"), []byte(hex.EncodeToString(sum[:])+"  app.tar.gz\n"), 0644))
+
+	v := newArtifactVerifier(&cfg.VerificationConfig{
+		Checksum: &cfg.ChecksumVerification{Suffix: ".sha256"},
+	}, nil)
+
+	require.NoError(t, v.verify(context.Background(), bm, "app.tar.gz", 0, f))
+}
+
+func TestArtifactVerifier_Checksum_Mismatch(t *testing.T) {
+	root := t.TempDir()
+	bm := filesystemBucketManager(t, root)
+	f := writeArtifact(t, root)
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "app.tar.gz.sha256"), []byte("0000000000000000000000000000000000000000000000000000000000000000  app.tar.gz\n"), 0644))
+
+	v := newArtifactVerifier(&cfg.VerificationConfig{
+		Checksum: &cfg.ChecksumVerification{Suffix: ".sha256"},
+	}, nil)
+
+	err := v.verify(context.Background(), bm, "app.tar.gz", 0, f)
+	require.ErrorIs(t, err, ErrVerificationFailure)
+}
+
+func TestArtifactVerifier_Signature(t *testing.T) {
+	root := t.TempDir()
+	bm := filesystemBucketManager(t, root)
+	f := writeArtifact(t, root)
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	sig := ed25519.Sign(priv, []byte("artifact contents"))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "app.tar.gz.sig"), []byte(base64.StdEncoding.EncodeToString(sig)), 0644))
+
+	v := newArtifactVerifier(&cfg.VerificationConfig{
+		Signature: &cfg.SignatureVerification{
+			Suffix:     ".sig",
+			PublicKeys: []string{base64.StdEncoding.EncodeToString(pub)},
+		},
+	}, nil)
+
+	require.NoError(t, v.verify(context.Background(), bm, "app.tar.gz", 0, f))
+}
+
+func TestArtifactVerifier_Signature_WrongKey(t *testing.T) {
+	root := t.TempDir()
+	bm := filesystemBucketManager(t, root)
+	f := writeArtifact(t, root)
+
+	_, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	sig := ed25519.Sign(priv, []byte("artifact contents"))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "app.tar.gz.sig"), []byte(base64.StdEncoding.EncodeToString(sig)), 0644))
+
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	v := newArtifactVerifier(&cfg.VerificationConfig{
+		Signature: &cfg.SignatureVerification{
+			Suffix:     ".sig",
+			PublicKeys: []string{base64.StdEncoding.EncodeToString(otherPub)},
+		},
+	}, nil)
+
+	err = v.verify(context.Background(), bm, "app.tar.gz", 0, f)
+	require.ErrorIs(t, err, ErrVerificationFailure)
+}
+
+func TestParseSignaturePublicKey_PEM(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+	pemStr := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	got, err := parseSignaturePublicKey(pemStr)
+	require.NoError(t, err)
+	assert.Equal(t, pub, got)
+}
+
+func TestVerifyCertificateIdentity(t *testing.T) {
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "test"},
+		EmailAddresses: []string{"builder@example.com"},
+	}
+
+	assert.NoError(t, verifyCertificateIdentity(cert, "", ""))
+	assert.NoError(t, verifyCertificateIdentity(cert, "", "builder@example.com"))
+
+	err := verifyCertificateIdentity(cert, "", "someone-else@example.com")
+	require.ErrorIs(t, err, ErrVerificationFailure)
+}
+
+func TestVerifyCertificateIdentity_Issuer(t *testing.T) {
+	issuerExt := func(issuer string) pkix.Extension {
+		value, err := asn1.Marshal(issuer)
+		require.NoError(t, err)
+		return pkix.Extension{Id: fulcioIssuerOID, Value: value}
+	}
+
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "test"},
+		EmailAddresses: []string{"builder@example.com"},
+		Extensions:     []pkix.Extension{issuerExt("https://accounts.google.com")},
+	}
+
+	assert.NoError(t, verifyCertificateIdentity(cert, "https://accounts.google.com", "builder@example.com"))
+
+	err := verifyCertificateIdentity(cert, "https://github.com/login/oauth", "builder@example.com")
+	require.ErrorIs(t, err, ErrVerificationFailure)
+}
+
+// generateFulcioChain builds a self-signed fake Fulcio root and a leaf
+// certificate issued from it, valid over [notBefore, notAfter) and carrying
+// issuer/identity the way a real Fulcio cert would. It returns the leaf's
+// PEM, its private key, and the root's PEM.
+func generateFulcioChain(t *testing.T, notBefore, notAfter time.Time, issuer, identity string) (leafPEM []byte, leafKey *ecdsa.PrivateKey, rootPEM []byte) {
+	t.Helper()
+
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rootTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake fulcio root"},
+		NotBefore:             time.Now().Add(-365 * 24 * time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTmpl, rootTmpl, &rootKey.PublicKey, rootKey)
+	require.NoError(t, err)
+	rootCert, err := x509.ParseCertificate(rootDER)
+	require.NoError(t, err)
+	rootPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: rootDER})
+
+	leafKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	issuerExtValue, err := asn1.Marshal(issuer)
+	require.NoError(t, err)
+
+	leafTmpl := &x509.Certificate{
+		SerialNumber:   big.NewInt(2),
+		Subject:        pkix.Name{CommonName: "fake signer"},
+		NotBefore:      notBefore,
+		NotAfter:       notAfter,
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		EmailAddresses: []string{identity},
+		ExtraExtensions: []pkix.Extension{
+			{Id: fulcioIssuerOID, Value: issuerExtValue},
+		},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTmpl, rootCert, &leafKey.PublicKey, rootKey)
+	require.NoError(t, err)
+	leafPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER})
+
+	return leafPEM, leafKey, rootPEM
+}
+
+// fakeFulcioServer serves rootPEM at /api/v1/rootCert, the same endpoint
+// verifyFulcioChain fetches from a real Fulcio instance.
+func fakeFulcioServer(t *testing.T, rootPEM []byte) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(rootPEM)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// fakeRekorServer serves a single log entry at /api/v1/log/entries, recorded
+// at integratedTime and containing loggedSig -- which, to exercise a
+// mismatching entry, the caller may pass as something other than the
+// signature actually being verified.
+func fakeRekorServer(t *testing.T, loggedSig []byte, integratedTime time.Time) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bodyB64 := base64.StdEncoding.EncodeToString([]byte(base64.StdEncoding.EncodeToString(loggedSig)))
+		entries := map[string]any{
+			"fake-uuid": map[string]any{
+				"body":           bodyB64,
+				"integratedTime": integratedTime.Unix(),
+			},
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(entries))
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func writeKeylessBundle(t *testing.T, root, suffix string, leafPEM []byte, sig []byte, logIndex int64) {
+	t.Helper()
+	bundle := keylessBundle{
+		Certificate: string(leafPEM),
+		Signature:   base64.StdEncoding.EncodeToString(sig),
+		LogIndex:    logIndex,
+	}
+	raw, err := json.Marshal(bundle)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(root, "app.tar.gz"+suffix), raw, 0644))
+}
+
+func TestArtifactVerifier_Keyless_Valid(t *testing.T) {
+	root := t.TempDir()
+	bm := filesystemBucketManager(t, root)
+	f := writeArtifact(t, root)
+
+	// S3Grabber verifies this long after it was signed -- the Rekor
+	// timestamp, not wall-clock now, must be what the cert's ~10-minute
+	// validity window is checked against.
+	loggedAt := time.Now().Add(-48 * time.Hour)
+	leafPEM, leafKey, rootPEM := generateFulcioChain(t, loggedAt.Add(-time.Minute), loggedAt.Add(9*time.Minute), "https://accounts.google.com", "builder@example.com")
+
+	digest := sha256.Sum256([]byte("artifact contents"))
+	sig, err := ecdsa.SignASN1(rand.Reader, leafKey, digest[:])
+	require.NoError(t, err)
+
+	writeKeylessBundle(t, root, ".bundle", leafPEM, sig, 42)
+
+	fulcioTS := fakeFulcioServer(t, rootPEM)
+	rekorTS := fakeRekorServer(t, sig, loggedAt)
+
+	v := newArtifactVerifier(&cfg.VerificationConfig{
+		Keyless: &cfg.KeylessVerification{
+			Suffix:    ".bundle",
+			FulcioURL: fulcioTS.URL,
+			RekorURL:  rekorTS.URL,
+			Issuer:    "https://accounts.google.com",
+			Identity:  "builder@example.com",
+		},
+	}, nil)
+
+	require.NoError(t, v.verify(context.Background(), bm, "app.tar.gz", 0, f))
+}
+
+func TestArtifactVerifier_Keyless_ExpiredCert(t *testing.T) {
+	root := t.TempDir()
+	bm := filesystemBucketManager(t, root)
+	f := writeArtifact(t, root)
+
+	// loggedAt falls well outside the cert's validity window, as if the
+	// cert had already expired by the time it was used to sign.
+	certWindowStart := time.Now().Add(-48 * time.Hour)
+	loggedAt := certWindowStart.Add(time.Hour)
+	leafPEM, leafKey, rootPEM := generateFulcioChain(t, certWindowStart, certWindowStart.Add(10*time.Minute), "https://accounts.google.com", "builder@example.com")
+
+	digest := sha256.Sum256([]byte("artifact contents"))
+	sig, err := ecdsa.SignASN1(rand.Reader, leafKey, digest[:])
+	require.NoError(t, err)
+
+	writeKeylessBundle(t, root, ".bundle", leafPEM, sig, 42)
+
+	fulcioTS := fakeFulcioServer(t, rootPEM)
+	rekorTS := fakeRekorServer(t, sig, loggedAt)
+
+	v := newArtifactVerifier(&cfg.VerificationConfig{
+		Keyless: &cfg.KeylessVerification{
+			Suffix:    ".bundle",
+			FulcioURL: fulcioTS.URL,
+			RekorURL:  rekorTS.URL,
+			Issuer:    "https://accounts.google.com",
+			Identity:  "builder@example.com",
+		},
+	}, nil)
+
+	err = v.verify(context.Background(), bm, "app.tar.gz", 0, f)
+	require.ErrorIs(t, err, ErrVerificationFailure)
+}
+
+func TestArtifactVerifier_Keyless_IssuerMismatch(t *testing.T) {
+	root := t.TempDir()
+	bm := filesystemBucketManager(t, root)
+	f := writeArtifact(t, root)
+
+	loggedAt := time.Now().Add(-time.Hour)
+	leafPEM, leafKey, rootPEM := generateFulcioChain(t, loggedAt.Add(-time.Minute), loggedAt.Add(9*time.Minute), "https://github.com/login/oauth", "builder@example.com")
+
+	digest := sha256.Sum256([]byte("artifact contents"))
+	sig, err := ecdsa.SignASN1(rand.Reader, leafKey, digest[:])
+	require.NoError(t, err)
+
+	writeKeylessBundle(t, root, ".bundle", leafPEM, sig, 42)
+
+	fulcioTS := fakeFulcioServer(t, rootPEM)
+	rekorTS := fakeRekorServer(t, sig, loggedAt)
+
+	v := newArtifactVerifier(&cfg.VerificationConfig{
+		Keyless: &cfg.KeylessVerification{
+			Suffix:    ".bundle",
+			FulcioURL: fulcioTS.URL,
+			RekorURL:  rekorTS.URL,
+			Issuer:    "https://accounts.google.com",
+			Identity:  "builder@example.com",
+		},
+	}, nil)
+
+	err = v.verify(context.Background(), bm, "app.tar.gz", 0, f)
+	require.ErrorIs(t, err, ErrVerificationFailure)
+}
+
+func TestArtifactVerifier_Keyless_RekorMismatch(t *testing.T) {
+	root := t.TempDir()
+	bm := filesystemBucketManager(t, root)
+	f := writeArtifact(t, root)
+
+	loggedAt := time.Now().Add(-time.Hour)
+	leafPEM, leafKey, rootPEM := generateFulcioChain(t, loggedAt.Add(-time.Minute), loggedAt.Add(9*time.Minute), "https://accounts.google.com", "builder@example.com")
+
+	digest := sha256.Sum256([]byte("artifact contents"))
+	sig, err := ecdsa.SignASN1(rand.Reader, leafKey, digest[:])
+	require.NoError(t, err)
+
+	writeKeylessBundle(t, root, ".bundle", leafPEM, sig, 42)
+
+	fulcioTS := fakeFulcioServer(t, rootPEM)
+	// Rekor recorded a different signature than the one in the bundle.
+	otherSig := append([]byte(nil), sig...)
+	otherSig[0] ^= 0xFF
+	rekorTS := fakeRekorServer(t, otherSig, loggedAt)
+
+	v := newArtifactVerifier(&cfg.VerificationConfig{
+		Keyless: &cfg.KeylessVerification{
+			Suffix:    ".bundle",
+			FulcioURL: fulcioTS.URL,
+			RekorURL:  rekorTS.URL,
+			Issuer:    "https://accounts.google.com",
+			Identity:  "builder@example.com",
+		},
+	}, nil)
+
+	err = v.verify(context.Background(), bm, "app.tar.gz", 0, f)
+	require.ErrorIs(t, err, ErrVerificationFailure)
+	assert.Contains(t, err.Error(), fmt.Sprintf("no Rekor entry at index %d", int64(42)))
+}
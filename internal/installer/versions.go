@@ -0,0 +1,148 @@
+package installer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/vinted/S3Grabber/internal/cfg"
+)
+
+// generationTimeFormat produces lexically sortable, filesystem-safe
+// generation directory names.
+const generationTimeFormat = "20060102T150405.000000000Z"
+
+// versionsDir is where each successful install keeps its own directory,
+// named after the generation's timestamp, so installInto can be a symlink
+// pointing at whichever one is current.
+func versionsDir(installInto string) string {
+	return installInto + ".versions"
+}
+
+// versionsMetaPath is a small JSON index next to versionsDir recording every
+// generation still on disk and the source modification time it was
+// installed for, so that state survives a process restart.
+func versionsMetaPath(installInto string) string {
+	return installInto + ".versions.json"
+}
+
+// Generation describes one successful install kept under versionsDir.
+type Generation struct {
+	Timestamp     time.Time `json:"timestamp"`
+	SourceModTime time.Time `json:"source_mod_time"`
+}
+
+func (g Generation) dir(installInto string) string {
+	return filepath.Join(versionsDir(installInto), g.Timestamp.Format(generationTimeFormat))
+}
+
+type versionsMeta struct {
+	Generations []Generation `json:"generations"`
+}
+
+func loadVersionsMeta(installInto string) (*versionsMeta, error) {
+	raw, err := os.ReadFile(versionsMetaPath(installInto))
+	if os.IsNotExist(err) {
+		return &versionsMeta{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", versionsMetaPath(installInto), err)
+	}
+
+	var m versionsMeta
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", versionsMetaPath(installInto), err)
+	}
+	return &m, nil
+}
+
+// save writes m to versionsMetaPath atomically, via a temp file and rename.
+func (m *versionsMeta) save(installInto string) error {
+	raw, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling versions metadata: %w", err)
+	}
+
+	tmp := versionsMetaPath(installInto) + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0644); err != nil {
+		return fmt.Errorf("writing %s: %w", tmp, err)
+	}
+	return os.Rename(tmp, versionsMetaPath(installInto))
+}
+
+// latest returns the most recently added generation, or false if none exist
+// yet (e.g. before the first install, or on a tree installed before
+// versioned installs existed).
+func (m *versionsMeta) latest() (Generation, bool) {
+	if len(m.Generations) == 0 {
+		return Generation{}, false
+	}
+	return m.Generations[len(m.Generations)-1], true
+}
+
+// nextGenerationTimestamp picks a generation timestamp for installInto that doesn't
+// collide with one already on disk, nudging forward by a nanosecond at a
+// time in the (practically unlikely) case two installs land in the same
+// instant.
+func nextGenerationTimestamp(installInto string) time.Time {
+	ts := time.Now().UTC()
+	for {
+		if _, err := os.Stat(filepath.Join(versionsDir(installInto), ts.Format(generationTimeFormat))); os.IsNotExist(err) {
+			return ts
+		}
+		ts = ts.Add(time.Nanosecond)
+	}
+}
+
+// prune applies retention's restic-forget-style rules, removing the
+// directories of generations it drops and dropping them from m.Generations.
+// The newest generation is always kept, regardless of retention, so there is
+// always somewhere for Rollback to go back to. Leaving both KeepLast and
+// KeepWithin at zero keeps every generation.
+func (m *versionsMeta) prune(installInto string, retention cfg.RetentionConfig) error {
+	if retention.KeepLast == 0 && retention.KeepWithin == 0 {
+		return nil
+	}
+	if len(m.Generations) <= 1 {
+		return nil
+	}
+
+	newestFirst := append([]Generation(nil), m.Generations...)
+	sort.Slice(newestFirst, func(i, j int) bool { return newestFirst[i].Timestamp.After(newestFirst[j].Timestamp) })
+
+	keep := make(map[time.Time]bool, len(newestFirst))
+	keep[newestFirst[0].Timestamp] = true
+	for i, g := range newestFirst {
+		if retention.KeepLast > 0 && i < retention.KeepLast {
+			keep[g.Timestamp] = true
+		}
+		if retention.KeepWithin > 0 && time.Since(g.Timestamp) <= retention.KeepWithin {
+			keep[g.Timestamp] = true
+		}
+	}
+
+	var kept []Generation
+	for _, g := range m.Generations {
+		if keep[g.Timestamp] {
+			kept = append(kept, g)
+			continue
+		}
+		if err := os.RemoveAll(g.dir(installInto)); err != nil {
+			return fmt.Errorf("removing generation %s: %w", g.Timestamp, err)
+		}
+	}
+	m.Generations = kept
+	return nil
+}
+
+// ListGenerations returns every generation still on disk for a grabber's
+// Path, oldest first, for use by the "list-generations" CLI subcommand.
+func ListGenerations(installInto string) ([]Generation, error) {
+	meta, err := loadVersionsMeta(installInto)
+	if err != nil {
+		return nil, err
+	}
+	return meta.Generations, nil
+}
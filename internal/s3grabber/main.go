@@ -3,50 +3,93 @@ package s3grabber
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"sync"
 
-	"github.com/go-kit/log"
+	"github.com/hashicorp/go-multierror"
 	"github.com/oklog/run"
 	"github.com/vinted/S3Grabber/internal/cfg"
 	"github.com/vinted/S3Grabber/internal/downloader"
 	"github.com/vinted/S3Grabber/internal/installer"
 )
 
-func RunS3Grabber(logger log.Logger, config cfg.GlobalConfig) (bool, error) {
+func RunS3Grabber(logger *slog.Logger, config cfg.GlobalConfig, metrics *downloader.Metrics, installerMetrics *installer.Metrics) (bool, error) {
 	var (
 		globalAttemptedInstall bool
 		globalInstallMtx       sync.Mutex
+		errs                   error
 	)
+
+	gctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	installers := make([]*installer.Installer, 0, len(config.Grabbers))
 	for grabberName, grabber := range config.Grabbers {
 		bucketCfgs := []cfg.BucketConfig{}
+		missingBucket := false
 		for _, bktName := range grabber.Buckets {
 			bkt, ok := config.Buckets[bktName]
 			if !ok {
-				return globalAttemptedInstall, fmt.Errorf("failed to find bucket %s for grabber %s", bktName, grabberName)
+				errs = multierror.Append(errs, fmt.Errorf("failed to find bucket %s for grabber %s", bktName, grabberName))
+				missingBucket = true
+				break
 			}
 			bucketCfgs = append(bucketCfgs, bkt)
 		}
+		if missingBucket {
+			continue
+		}
 
-		bm, err := downloader.NewBucketManager(bucketCfgs)
+		grabberLogger := logger.With("grabber", grabberName)
+
+		// A bucket's credentials_source may be temporarily unreachable (a
+		// Secret not yet created, an endpoint down, etc.), so a failure here
+		// only skips this grabber for this sync rather than the whole run.
+		bm, err := downloader.NewBucketManager(gctx, bucketCfgs, grabber.Downloads, metrics, grabberLogger)
 		if err != nil {
-			return globalAttemptedInstall, fmt.Errorf("constructing bucket manager for grabber %s: %w", grabberName, err)
+			errs = multierror.Append(errs, fmt.Errorf("constructing bucket manager for grabber %s: %w", grabberName, err))
+			continue
 		}
 
 		if grabber.File != nil {
-			installers = append(installers, installer.NewArchiveInstaller(grabberName, bm, grabber.Commands, *grabber.File, grabber.Path, grabber.Shell, grabber.Timeout, logger))
+			inst, err := installer.NewArchiveInstaller(grabberName, bm, bucketCfgs, grabber.Commands, grabber.RollbackCommands, *grabber.File, grabber.Path, grabber.Shell, grabber.Timeout, grabber.Keep, grabber.Remove, grabber.Retention, grabber.Verification, installerMetrics, grabberLogger)
+			if err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("constructing installer for grabber %s: %w", grabberName, err))
+				continue
+			}
+			installers = append(installers, inst)
 		} else if grabber.Dir != nil {
-			installers = append(installers, installer.NewDirectoryInstaller(grabberName, bm, grabber.Commands, *grabber.Dir, grabber.Path, grabber.Shell, grabber.Timeout, logger))
+			inst, err := installer.NewDirectoryInstaller(grabberName, bm, bucketCfgs, grabber.Commands, grabber.RollbackCommands, *grabber.Dir, grabber.Path, grabber.Shell, grabber.Timeout, grabber.Keep, grabber.Remove, grabber.Retention, grabber.Verification, installerMetrics, grabberLogger)
+			if err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("constructing installer for grabber %s: %w", grabberName, err))
+				continue
+			}
+			installers = append(installers, inst)
 		}
 	}
 
 	g := &run.Group{}
-	gctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+
+	// maxConcurrentGrabbers bounds how many installs run at once. A goroutine
+	// is still started per grabber (run.Group's interrupt semantics need
+	// that), but all but config.MaxConcurrentGrabbers of them sit waiting on
+	// sem until a slot frees up.
+	maxConcurrentGrabbers := config.MaxConcurrentGrabbers
+	if maxConcurrentGrabbers <= 0 || maxConcurrentGrabbers > len(installers) {
+		maxConcurrentGrabbers = len(installers)
+	}
+	sem := make(chan struct{}, maxConcurrentGrabbers)
 
 	for _, i := range installers {
 		i := i
 		g.Add(func() error {
+			select {
+			case sem <- struct{}{}:
+			case <-gctx.Done():
+				return gctx.Err()
+			}
+			defer func() { <-sem }()
+
 			ctx, cancel := context.WithTimeout(gctx, i.GetTimeout())
 			defer cancel()
 
@@ -65,8 +108,23 @@ func RunS3Grabber(logger log.Logger, config cfg.GlobalConfig) (bool, error) {
 	}
 
 	if err := g.Run(); err != nil {
-		return globalAttemptedInstall, fmt.Errorf("failed running grabbers: %w", err)
+		errs = multierror.Append(errs, fmt.Errorf("failed running grabbers: %w", err))
+	}
+
+	return globalAttemptedInstall, errs
+}
+
+// RunS3GrabberOne runs a sync for a single named grabber, as triggered by an
+// external event (e.g. the HTTP endpoint in cmd/s3grabber) rather than the
+// interval polling loop. It shares RunS3Grabber's install logic and error
+// semantics, scoped down to just this grabber.
+func RunS3GrabberOne(logger *slog.Logger, config cfg.GlobalConfig, metrics *downloader.Metrics, installerMetrics *installer.Metrics, grabberName string) (bool, error) {
+	grabber, ok := config.Grabbers[grabberName]
+	if !ok {
+		return false, fmt.Errorf("no such grabber: %s", grabberName)
 	}
 
-	return globalAttemptedInstall, nil
+	scoped := config
+	scoped.Grabbers = map[string]cfg.GrabberConfig{grabberName: grabber}
+	return RunS3Grabber(logger, scoped, metrics, installerMetrics)
 }
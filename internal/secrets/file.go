@@ -0,0 +1,46 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vinted/S3Grabber/internal/cfg"
+)
+
+// fileSource reads credentials from a directory of CSI-mounted secret
+// files, one file per field.
+type fileSource struct {
+	cfg cfg.FileSecretSource
+}
+
+func (s *fileSource) Resolve(ctx context.Context) (Credentials, error) {
+	accessKey, err := s.readField(s.cfg.AccessKeyFile)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("reading access key: %w", err)
+	}
+	secretKey, err := s.readField(s.cfg.SecretKeyFile)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("reading secret key: %w", err)
+	}
+
+	var sessionToken string
+	if s.cfg.SessionTokenFile != "" {
+		sessionToken, err = s.readField(s.cfg.SessionTokenFile)
+		if err != nil {
+			return Credentials{}, fmt.Errorf("reading session token: %w", err)
+		}
+	}
+
+	return Credentials{AccessKey: accessKey, SecretKey: secretKey, SessionToken: sessionToken}, nil
+}
+
+func (s *fileSource) readField(name string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(s.cfg.Dir, name))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(content), "\n"), nil
+}
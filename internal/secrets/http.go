@@ -0,0 +1,51 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/vinted/S3Grabber/internal/cfg"
+)
+
+// httpSource fetches credentials from a JSON HTTP endpoint.
+type httpSource struct {
+	cfg cfg.HTTPSecretSource
+}
+
+type httpSecretResponse struct {
+	AccessKey    string `json:"access_key"`
+	SecretKey    string `json:"secret_key"`
+	SessionToken string `json:"session_token"`
+}
+
+func (s *httpSource) Resolve(ctx context.Context) (Credentials, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.cfg.URL, nil)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("building request for %s: %w", s.cfg.URL, err)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("fetching %s: %w", s.cfg.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Credentials{}, fmt.Errorf("fetching %s: unexpected status %s", s.cfg.URL, resp.Status)
+	}
+
+	var parsed httpSecretResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return Credentials{}, fmt.Errorf("decoding response from %s: %w", s.cfg.URL, err)
+	}
+
+	return Credentials{
+		AccessKey:    parsed.AccessKey,
+		SecretKey:    parsed.SecretKey,
+		SessionToken: parsed.SessionToken,
+	}, nil
+}
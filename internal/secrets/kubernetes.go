@@ -0,0 +1,142 @@
+package secrets
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/vinted/S3Grabber/internal/cfg"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	tokenPath         = serviceAccountDir + "/token"
+	caCertPath        = serviceAccountDir + "/ca.crt"
+)
+
+// kubernetesSource fetches a Secret from the in-cluster Kubernetes API
+// server, authenticating as the pod's own service account. It deliberately
+// avoids a client-go dependency: it's a single GET request against the core
+// v1 Secrets API.
+type kubernetesSource struct {
+	cfg       cfg.KubernetesSecretSource
+	apiServer string
+}
+
+func newKubernetesSource(c cfg.KubernetesSecretSource) (*kubernetesSource, error) {
+	if c.Namespace == "" || c.Name == "" {
+		return nil, fmt.Errorf("kubernetes credentials source: namespace and name are required")
+	}
+	if c.FieldAccessKey == "" || c.FieldSecretKey == "" {
+		return nil, fmt.Errorf("kubernetes credentials source: field_access_key and field_secret_key are required")
+	}
+
+	host := os.Getenv("KUBERNETES_SERVICE_HOST")
+	port := os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("kubernetes credentials source: KUBERNETES_SERVICE_HOST/KUBERNETES_SERVICE_PORT not set -- not running in a cluster?")
+	}
+
+	return &kubernetesSource{
+		cfg:       c,
+		apiServer: fmt.Sprintf("https://%s:%s", host, port),
+	}, nil
+}
+
+// secret mirrors just the part of a Kubernetes core/v1 Secret response we
+// need: Data maps each key to its base64-encoded value.
+type secret struct {
+	Data map[string]string `json:"data"`
+}
+
+func (s *kubernetesSource) Resolve(ctx context.Context) (Credentials, error) {
+	// The token is a short-lived, automatically rotated projected volume, so
+	// it's read fresh on every call rather than cached.
+	token, err := os.ReadFile(tokenPath)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("reading service account token: %w", err)
+	}
+
+	client, err := s.httpClient()
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	url := fmt.Sprintf("%s/api/v1/namespaces/%s/secrets/%s", s.apiServer, s.cfg.Namespace, s.cfg.Name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("building request for %s: %w", url, err)
+	}
+	req.Header.Set("Authorization", "Bearer "+string(token))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("fetching secret %s/%s: %w", s.cfg.Namespace, s.cfg.Name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Credentials{}, fmt.Errorf("fetching secret %s/%s: unexpected status %s", s.cfg.Namespace, s.cfg.Name, resp.Status)
+	}
+
+	var parsed secret
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return Credentials{}, fmt.Errorf("decoding secret %s/%s: %w", s.cfg.Namespace, s.cfg.Name, err)
+	}
+
+	accessKey, err := decodeField(parsed, s.cfg.FieldAccessKey)
+	if err != nil {
+		return Credentials{}, err
+	}
+	secretKey, err := decodeField(parsed, s.cfg.FieldSecretKey)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	var sessionToken string
+	if s.cfg.FieldSessionToken != "" {
+		sessionToken, err = decodeField(parsed, s.cfg.FieldSessionToken)
+		if err != nil {
+			return Credentials{}, err
+		}
+	}
+
+	return Credentials{AccessKey: accessKey, SecretKey: secretKey, SessionToken: sessionToken}, nil
+}
+
+func decodeField(s secret, field string) (string, error) {
+	raw, ok := s.Data[field]
+	if !ok {
+		return "", fmt.Errorf("secret has no data field %q", field)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return "", fmt.Errorf("decoding data field %q: %w", field, err)
+	}
+	return string(decoded), nil
+}
+
+func (s *kubernetesSource) httpClient() (*http.Client, error) {
+	caCert, err := os.ReadFile(caCertPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading cluster CA certificate: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("parsing cluster CA certificate %s", caCertPath)
+	}
+
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		},
+	}, nil
+}
@@ -0,0 +1,54 @@
+// Package secrets resolves bucket credentials from the external stores
+// configurable via cfg.CredentialsSourceConfig, as an alternative to putting
+// them directly (or via ${env}) in a bucket's access_key/secret_key.
+package secrets
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vinted/S3Grabber/internal/cfg"
+)
+
+// Credentials is what a Source resolves a bucket's credentials to.
+// SessionToken is optional and left empty when the source doesn't provide
+// one.
+type Credentials struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+}
+
+// Source resolves a bucket's Credentials from an external store. Resolve is
+// called on every sync, so implementations should not cache beyond the
+// lifetime of a single call -- that's what lets a rotated secret be picked
+// up without restarting S3Grabber.
+type Source interface {
+	Resolve(ctx context.Context) (Credentials, error)
+}
+
+// NewSource builds a Source from c. It returns an error if more than one of
+// Kubernetes/File/HTTP is set.
+func NewSource(c *cfg.CredentialsSourceConfig) (Source, error) {
+	set := 0
+	for _, ok := range []bool{c.Kubernetes != nil, c.File != nil, c.HTTP != nil} {
+		if ok {
+			set++
+		}
+	}
+	if set == 0 {
+		return nil, fmt.Errorf("credentials_source given but none of kubernetes, file or http is set")
+	}
+	if set > 1 {
+		return nil, fmt.Errorf("credentials_source: only one of kubernetes, file or http may be set")
+	}
+
+	switch {
+	case c.Kubernetes != nil:
+		return newKubernetesSource(*c.Kubernetes)
+	case c.File != nil:
+		return &fileSource{cfg: *c.File}, nil
+	default:
+		return &httpSource{cfg: *c.HTTP}, nil
+	}
+}
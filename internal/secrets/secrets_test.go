@@ -0,0 +1,66 @@
+package secrets_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vinted/S3Grabber/internal/cfg"
+	"github.com/vinted/S3Grabber/internal/secrets"
+)
+
+func TestNewSource_RejectsAmbiguousConfig(t *testing.T) {
+	_, err := secrets.NewSource(&cfg.CredentialsSourceConfig{})
+	require.Error(t, err)
+
+	_, err = secrets.NewSource(&cfg.CredentialsSourceConfig{
+		File: &cfg.FileSecretSource{},
+		HTTP: &cfg.HTTPSecretSource{},
+	})
+	require.Error(t, err)
+}
+
+func TestFileSource_Resolve(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "access_key"), []byte("AKIA123\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "secret_key"), []byte("shh"), 0644))
+
+	source, err := secrets.NewSource(&cfg.CredentialsSourceConfig{
+		File: &cfg.FileSecretSource{
+			Dir:           dir,
+			AccessKeyFile: "access_key",
+			SecretKeyFile: "secret_key",
+		},
+	})
+	require.NoError(t, err)
+
+	creds, err := source.Resolve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, secrets.Credentials{AccessKey: "AKIA123", SecretKey: "shh"}, creds)
+}
+
+func TestHTTPSource_Resolve(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"access_key":    "AKIA123",
+			"secret_key":    "shh",
+			"session_token": "tok",
+		})
+	}))
+	t.Cleanup(ts.Close)
+
+	source, err := secrets.NewSource(&cfg.CredentialsSourceConfig{
+		HTTP: &cfg.HTTPSecretSource{URL: ts.URL},
+	})
+	require.NoError(t, err)
+
+	creds, err := source.Resolve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, secrets.Credentials{AccessKey: "AKIA123", SecretKey: "shh", SessionToken: "tok"}, creds)
+}
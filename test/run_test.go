@@ -4,12 +4,12 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
 
-	"github.com/go-kit/log"
 	"github.com/stretchr/testify/require"
 	"github.com/vinted/S3Grabber/internal/cfg"
 	"github.com/vinted/S3Grabber/internal/downloader"
@@ -68,16 +68,16 @@ func TestS3GrabberMain(t *testing.T) {
 			},
 		},
 	}
-	attemptedInstall, err := s3grabber.RunS3Grabber(log.NewLogfmtLogger(os.Stderr), grabberCfg)
+	attemptedInstall, err := s3grabber.RunS3Grabber(slog.New(slog.NewTextHandler(os.Stderr, nil)), grabberCfg, nil, nil)
 	require.Error(t, err)
 	require.False(t, attemptedInstall)
 	require.Contains(t, err.Error(), "The specified bucket does not exist")
 
 	// Upload the file to both buckets.
 	time.Sleep(1 * time.Second) // To ensure ctime < modify time.
-	bm, err := downloader.NewBucketManager([]cfg.BucketConfig{
+	bm, err := downloader.NewBucketManager(context.Background(), []cfg.BucketConfig{
 		grabberCfg.Buckets["test1"], grabberCfg.Buckets["test2"],
-	})
+	}, cfg.DownloadLimits{}, nil, nil)
 	require.NoError(t, err)
 
 	// Only upload to one bucket to check whether it works properly.
@@ -87,7 +87,7 @@ func TestS3GrabberMain(t *testing.T) {
 	require.NoError(t, bm.PutFile(context.Background(), "dir_file1.txt", "exampledir/dir_file1.txt", 1))
 	require.NoError(t, bm.PutFile(context.Background(), "dir_file2.txt", "exampledir/dir_file2.txt", 1))
 
-	attemptedInstall, err = s3grabber.RunS3Grabber(log.NewLogfmtLogger(os.Stderr), grabberCfg)
+	attemptedInstall, err = s3grabber.RunS3Grabber(slog.New(slog.NewTextHandler(os.Stderr, nil)), grabberCfg, nil, nil)
 	require.NoError(t, err)
 	require.True(t, attemptedInstall)
 
@@ -99,7 +99,7 @@ func TestS3GrabberMain(t *testing.T) {
 
 	require.Nil(t, os.RemoveAll(tmpDirArchive))
 	require.Nil(t, os.MkdirAll(tmpDirArchive, os.ModePerm))
-	attemptedInstall, err = s3grabber.RunS3Grabber(log.NewLogfmtLogger(os.Stderr), grabberCfg)
+	attemptedInstall, err = s3grabber.RunS3Grabber(slog.New(slog.NewTextHandler(os.Stderr, nil)), grabberCfg, nil, nil)
 	require.NoError(t, err)
 	require.True(t, attemptedInstall)
 